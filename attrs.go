@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CellAttrs 是用覆盖层（overlay）声明的单元格属性：偶数格、奇数格、堡垒格。
+// 偶数格、奇数格开始时排除另一种奇偶的数；堡垒格的数大于上下左右相邻的所有非堡垒格，
+// 填数和排除候选数时，按大小关系排除相邻单元格的候选数。
+type CellAttrs struct {
+	//Overlay[r][c] 是单元格 (r,c) 的属性，见 cellAttrKinds，'.' 代表没有属性
+	Overlay [9][9]byte
+	//lower[r][c] 是必须小于 (r,c) 的相邻单元格，higher[r][c] 是必须大于 (r,c) 的相邻单元格
+	lower, higher [9][9][]RowCol
+}
+
+// cellAttrKinds 是覆盖层中可以使用的字符
+var cellAttrKinds = map[byte]string{
+	'e': "偶数格",
+	'o': "奇数格",
+	'f': "堡垒格",
+}
+
+const (
+	//偶数格可以填的数（2、4、6、8）的掩码
+	evenMask int16 = 0b010101010
+	//奇数格可以填的数（1、3、5、7、9）的掩码
+	oddMask int16 = 0b101010101
+)
+
+// ParseCellAttrs 解析 9 行 9 个字符的覆盖层：e 是偶数格，o 是奇数格，f 是堡垒格，. 是普通单元格
+func ParseCellAttrs(rows []string) (*CellAttrs, error) {
+	if len(rows) != 9 {
+		return nil, fmt.Errorf("overlay: expect 9 rows, got %d", len(rows))
+	}
+	a := &CellAttrs{}
+	for r, row := range rows {
+		if len(row) != 9 {
+			return nil, fmt.Errorf("overlay: row %d should have 9 characters", r+1)
+		}
+		for c := range 9 {
+			x := row[c]
+			if _, ok := cellAttrKinds[x]; !ok && x != '.' {
+				return nil, fmt.Errorf("overlay: invalid character %q at r%dc%d, expect e, o, f or .", x, r+1, c+1)
+			}
+			a.Overlay[r][c] = x
+		}
+	}
+	for r := range int8(9) {
+		for c := range int8(9) {
+			if a.Overlay[r][c] != 'f' {
+				continue
+			}
+			for _, move := range adjacentMoves {
+				r0, c0 := r+move.Row, c+move.Col
+				if r0 < 0 || r0 >= 9 || c0 < 0 || c0 >= 9 || a.Overlay[r0][c0] == 'f' {
+					continue
+				}
+				a.lower[r][c] = append(a.lower[r][c], RowCol{r0, c0})
+				a.higher[r0][c0] = append(a.higher[r0][c0], RowCol{r, c})
+			}
+		}
+	}
+	return a, nil
+}
+
+// SplitCellAttrs 从谜题文本中分离覆盖层：以 "overlay" 开头的一行之后的 9 行。
+// 返回去掉覆盖层的谜题，没有覆盖层时 CellAttrs 为 nil。
+func SplitCellAttrs(puzzle string) (string, *CellAttrs, error) {
+	lines := strings.Split(puzzle, "\n")
+	for k, line := range lines {
+		if strings.TrimSpace(line) != "overlay" {
+			continue
+		}
+		var rows []string
+		end := k + 1
+		for ; end < len(lines) && len(rows) < 9; end++ {
+			if row := strings.TrimSpace(lines[end]); row != "" {
+				rows = append(rows, row)
+			}
+		}
+		a, err := ParseCellAttrs(rows)
+		if err != nil {
+			return "", nil, err
+		}
+		rest := append(lines[:k:k], lines[end:]...)
+		return strings.Join(rest, "\n"), a, nil
+	}
+	return puzzle, nil, nil
+}
+
+// String 返回覆盖层的 9 行
+func (a *CellAttrs) String() string {
+	var sb strings.Builder
+	for r := range 9 {
+		sb.Write(a.Overlay[r][:])
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// mask 返回单元格 (r,c) 开始时可以填的数的掩码：奇偶格限制奇偶，
+// 有相邻的非堡垒格的堡垒格不能是 1，有相邻的堡垒格的单元格不能是 9
+func (a *CellAttrs) mask(r, c int8) int16 {
+	mask := int16(511)
+	switch a.Overlay[r][c] {
+	case 'e':
+		mask = evenMask
+	case 'o':
+		mask = oddMask
+	}
+	if len(a.lower[r][c]) > 0 {
+		mask &^= 1 << 0
+	}
+	if len(a.higher[r][c]) > 0 {
+		mask &^= 1 << 8
+	}
+	return mask
+}
+
+// SetCellAttrs 为局势启用单元格属性：排除属性不允许的数，并按堡垒格的大小关系排除。a 为 nil 时不做任何事。
+func (s *Situation) SetCellAttrs(t *Trigger, a *CellAttrs) {
+	if a == nil {
+		return
+	}
+	s.attrs = a
+	for r := range int8(9) {
+		for c := range int8(9) {
+			mask := a.mask(r, c)
+			for n := range int8(9) {
+				if mask&(1<<n) == 0 {
+					s.excludeOne(t, RCN(r, c, n))
+				}
+			}
+		}
+	}
+	for r := range int8(9) {
+		for c := range int8(9) {
+			s.applyCellAttrs(t, r, c)
+		}
+	}
+}
+
+// applyCellAttrs 在单元格 (r,c) 填数或者排除候选数之后，按堡垒格的大小关系排除相邻单元格的候选数：
+// 必须更小的单元格排除不小于 (r,c) 的最大候选数的数，必须更大的单元格排除不大于 (r,c) 的最小候选数的数
+func (s *Situation) applyCellAttrs(t *Trigger, r, c int8) {
+	lower, higher := s.attrs.lower[r][c], s.attrs.higher[r][c]
+	candidates := ^s.numExcludeMask[r][c] & 511
+	if len(lower)+len(higher) == 0 || candidates == 0 {
+		return
+	}
+	lo, hi := int8(0), int8(8)
+	for candidates&(1<<lo) == 0 {
+		lo++
+	}
+	for candidates&(1<<hi) == 0 {
+		hi--
+	}
+	for _, rc := range lower {
+		for n := hi; n < 9; n++ {
+			s.excludeOne(t, RCN(rc.Row, rc.Col, n))
+		}
+	}
+	for _, rc := range higher {
+		for n := range lo + 1 {
+			s.excludeOne(t, RCN(rc.Row, rc.Col, n))
+		}
+	}
+}
+
+// parityRule 限制偶数格、奇数格只能填 mask 中的数
+type parityRule struct {
+	name string
+	cell int
+	mask int16
+}
+
+func (x *parityRule) Propagate(g Board) bool {
+	changed := false
+	for n := range int8(9) {
+		if x.mask&(1<<n) == 0 && g.Exclude(x.cell, n) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+func (x *parityRule) Directive(l *Layout) string {
+	return fmt.Sprintf("# %s：%s", x.name, l.CellName(x.cell))
+}
+
+var fortressTable = newPairTable(relationKinds["gt"].holds)
+
+// apply 把单元格属性转换为变体数独的约束：奇偶格限制候选数，堡垒格与每个相邻的非堡垒格是一对大于关系
+func (a *CellAttrs) apply(l *Layout) []Constraint {
+	var rules []Constraint
+	for r := range int8(9) {
+		for c := range int8(9) {
+			i := l.Index(int(r), int(c))
+			switch x := a.Overlay[r][c]; x {
+			case 'e':
+				rules = append(rules, &parityRule{name: cellAttrKinds[x], cell: i, mask: evenMask})
+			case 'o':
+				rules = append(rules, &parityRule{name: cellAttrKinds[x], cell: i, mask: oddMask})
+			}
+			for _, rc := range a.lower[r][c] {
+				rules = append(rules, &pairRule{name: cellAttrKinds['f'], a: i, b: l.Index(int(rc.Row), int(rc.Col)), table: fortressTable})
+			}
+		}
+	}
+	return rules
+}
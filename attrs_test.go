@@ -0,0 +1,143 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// attrClauses 返回单元格属性的 SAT 子句，用于交叉检验
+func attrClauses(a *CellAttrs) [][]int {
+	var clauses [][]int
+	for r := range int8(9) {
+		for c := range int8(9) {
+			mask := int16(511)
+			switch a.Overlay[r][c] {
+			case 'e':
+				mask = evenMask
+			case 'o':
+				mask = oddMask
+			}
+			for n := range int8(9) {
+				if mask&(1<<n) == 0 {
+					clauses = append(clauses, []int{-SudokuVar(r, c, n)})
+				}
+				//堡垒格填 n 时，相邻的非堡垒格不能填 n 以上的数
+				for _, rc := range a.lower[r][c] {
+					for n0 := n; n0 < 9; n0++ {
+						clauses = append(clauses, []int{-SudokuVar(r, c, n), -SudokuVar(rc.Row, rc.Col, n0)})
+					}
+				}
+			}
+		}
+	}
+	return clauses
+}
+
+// splitAttrsPuzzle 读取带覆盖层的谜题文件，返回已知数和单元格属性
+func splitAttrsPuzzle(filename string) (*[9][9]int8, *CellAttrs) {
+	raw, err := os.ReadFile(filename)
+	check(err)
+	text, attrs, err := SplitCellAttrs(string(raw))
+	check(err)
+	s, trg := ParseSituation(text)
+	defer ReleaseSituation(s)
+	defer ReleaseTrigger(trg)
+	cells := s.cells
+	return &cells, attrs
+}
+
+func TestCellAttrsPuzzleFiles(t *testing.T) {
+	for _, name := range []string{"even-odd", "fortress"} {
+		filename := "puzzles/" + name + "-01.txt"
+		puzzle, attrs := splitAttrsPuzzle(filename)
+		if attrs == nil {
+			t.Fatalf("%s 没有覆盖层", filename)
+		}
+		sat := NewSATSolver()
+		sat.ExtraClauses = attrClauses(attrs)
+		if count := len(solveAll(sat, puzzle)); count != 1 {
+			t.Fatalf("%s 应该有唯一解，找到 %d 个", filename, count)
+		}
+		crossCheckSolvers(t, &PropagationSolver{Attrs: attrs}, sat, puzzle)
+
+		//清空解的前三行，得到有多个解的谜题
+		var multi [9][9]int8
+		for solution := range solveAll(sat, puzzle) {
+			multi = solution
+		}
+		for i := range 27 {
+			multi[i/9][i%9] = -1
+		}
+		crossCheckSolvers(t, &PropagationSolver{Attrs: attrs}, sat, &multi)
+		s, trg := NewSituationFromCells(&multi)
+		s.SetCellAttrs(trg, attrs)
+		ctx := &SudokuContext{Iterative: true}
+		if count := ctx.Run(s, trg); count != len(solveAll(sat, &multi)) {
+			t.Fatalf("%s：迭代搜索找到 %d 个解", filename, count)
+		}
+
+		//变体谜题文件用 overlay 指令声明同样的覆盖层
+		vp, err := ParseVariantPuzzle("overlay\n" + attrs.String() + formatPuzzle(puzzle))
+		check(err)
+		rules, err := NewVariantRules(vp)
+		check(err)
+		crossCheckSolvers(t, &PropagationSolver{Variant: rules}, sat, puzzle)
+		parsed, err := ParseVariantPuzzle(vp.String())
+		check(err)
+		if parsed.Attrs == nil || parsed.Attrs.Overlay != attrs.Overlay {
+			t.Fatalf("%s：导出后重新解析不一致", filename)
+		}
+	}
+}
+
+// formatPuzzle 返回 9 行的谜题文本
+func formatPuzzle(puzzle *[9][9]int8) string {
+	var sb strings.Builder
+	for r := range 9 {
+		for c := range 9 {
+			if n := puzzle[r][c]; n >= 0 {
+				sb.WriteByte(byte('1' + n))
+			} else {
+				sb.WriteByte('.')
+			}
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+func TestCellAttrsExclude(t *testing.T) {
+	rows := strings.Split(".........|.........|.........|.........|...efo...|.........|.........|.........|.........", "|")
+	attrs, err := ParseCellAttrs(rows)
+	check(err)
+	s, trg := ParseSituation("")
+	s.SetCellAttrs(trg, attrs)
+	if s.numExcludeMask[4][3] != oddMask|1<<8 || s.numExcludeMask[4][5] != evenMask|1<<8 {
+		t.Fatalf("奇偶格排除错误：%09b %09b", s.numExcludeMask[4][3], s.numExcludeMask[4][5])
+	}
+	//堡垒格左边的偶数格至少是 2，所以堡垒格至少是 3
+	if s.numExcludeMask[4][4] != 0b11 || s.numExcludeMask[3][4] != 1<<8 {
+		t.Fatalf("堡垒格排除错误：%09b %09b", s.numExcludeMask[4][4], s.numExcludeMask[3][4])
+	}
+	//堡垒格填 5，相邻的单元格排除 5~9
+	s.Set(trg, RCN(4, 4, 4))
+	if s.numExcludeMask[5][4]&0b111110000 != 0b111110000 || s.numExcludeMask[4][3]&(1<<5|1<<7) != 1<<5|1<<7 {
+		t.Fatalf("堡垒格填数后排除错误：%09b %09b", s.numExcludeMask[5][4], s.numExcludeMask[4][3])
+	}
+
+	//已知数违反覆盖层时发生矛盾
+	cells := EmptySituation.cells
+	cells[4][3] = 0
+	s, trg = NewSituationFromCells(&cells)
+	s.SetCellAttrs(trg, attrs)
+	if len(trg.Conflicts) == 0 {
+		t.Fatalf("偶数格填 1 应该矛盾")
+	}
+
+	for _, bad := range [][]string{rows[:8], append(rows[:8:8], "...x....."), append(rows[:8:8], "....")} {
+		if _, err := ParseCellAttrs(bad); err == nil {
+			t.Fatalf("应该返回错误：%q", bad)
+		}
+	}
+}
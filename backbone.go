@@ -0,0 +1,91 @@
+package main
+
+// CandidateAnalysis 是谜题所有解的候选分析结果
+type CandidateAnalysis struct {
+	//Possible[r][c] 的每一位代表单元格(r,c)在至少一个解中填了该数字
+	Possible [9][9]int16
+
+	//调用求解器测试候选数的次数
+	SolverCalls int
+
+	//各次求解共用的置换表的统计
+	Cache CacheStats
+}
+
+// Forced 返回单元格(r,c)是否在所有解中都是同一个数字
+func (a *CandidateAnalysis) Forced(r, c int8) bool {
+	return countTrueBits(a.Possible[r][c]) == 1
+}
+
+// ForcedCount 返回在所有解中都是同一个数字的单元格数量（即骨干的大小）
+func (a *CandidateAnalysis) ForcedCount() int {
+	count := 0
+	for r := range loop9 {
+		for c := range loop9 {
+			if a.Forced(int8(r), int8(c)) {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// AnalyzeCandidates 默认使用的置换表大小
+const analyzeCacheSize = 1 << 16
+
+// AnalyzeCandidates 计算局势 s 每个单元格在所有解中可能出现的数字，不需要列举全部解。
+// 对每个还没有被任何解覆盖的候选数，填入后用求解器找一个解：找到则把这个解的所有数记为可能，
+// 找不到则该候选数不可能出现。如果 s 无解，返回 false。
+func AnalyzeCandidates(s *Situation, t *Trigger) (*CandidateAnalysis, bool) {
+	return AnalyzeCandidatesWithCache(s, t, NewTranspositionCache(analyzeCacheSize))
+}
+
+// AnalyzeCandidatesWithCache 与 AnalyzeCandidates 相同，但各次试探使用指定的置换表，cache 为 nil 时不使用。
+// 各次试探会到达相同的局势，尤其是矛盾的局势。
+func AnalyzeCandidatesWithCache(s *Situation, t *Trigger, cache *TranspositionCache) (*CandidateAnalysis, bool) {
+	a := &CandidateAnalysis{}
+	s = DuplicateSituation(s)
+	t = DuplicateTrigger(t)
+	defer ReleaseSituation(s)
+	defer ReleaseTrigger(t)
+
+	ctx := NewSudokuContext()
+	if len(t.Conflicts) > 0 || !ctx.logicalEval(s, t) {
+		return a, false
+	}
+
+	addSolution := func(solution *[9][9]int8) {
+		for r := range loop9 {
+			for c := range loop9 {
+				a.Possible[r][c] |= 1 << solution[r][c]
+			}
+		}
+	}
+
+	if cache != nil {
+		defer func() { a.Cache = cache.Stats() }()
+	}
+
+	anySolution := false
+	for r := range loop9 {
+		for c := range loop9 {
+			for n := range loop9 {
+				if s.numExcludeMask[r][c]&(1<<n) != 0 || a.Possible[r][c]&(1<<n) != 0 {
+					continue
+				}
+				s2 := DuplicateSituation(s)
+				t2 := DuplicateTrigger(t)
+				s2.Set(t2, RCN(int8(r), int8(c), int8(n)))
+				ctx := &SudokuContext{StopAtFirstSolution: true, Cache: cache}
+				a.SolverCalls++
+				if ctx.Run(s2, t2) > 0 {
+					addSolution(ctx.solutions[0])
+					anySolution = true
+				}
+				ReleaseSituation(s2)
+				ReleaseTrigger(t2)
+			}
+		}
+	}
+	return a, anySolution
+}
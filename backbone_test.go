@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestAnalyzeCandidates(t *testing.T) {
+	puzzle, err := os.ReadFile("puzzles/hard-02.txt")
+	check(err)
+	//去掉第一行的线索，使谜题有多个解
+	s, trg := ParseSituation(".........\n" + string(puzzle[10:]))
+	givens := s.cells
+
+	var expected [9][9]int16
+	ctx := NewSudokuContext()
+	count := 0
+	for solution := range ctx.Solutions(DuplicateSituation(s), DuplicateTrigger(trg)) {
+		for r := range loop9 {
+			for c := range loop9 {
+				expected[r][c] |= 1 << solution[r][c]
+			}
+		}
+		count++
+	}
+	if count < 2 {
+		t.Fatalf("测试谜题应该有多个解，实际 %d 个", count)
+	}
+
+	a, ok := AnalyzeCandidates(s, trg)
+	if !ok {
+		t.Fatal("谜题应该有解")
+	}
+	if a.Possible != expected {
+		ShowCandidates(&a.Possible, "分析结果")
+		ShowCandidates(&expected, "列举结果")
+		t.Fatal("候选分析与列举全部解的结果不一致")
+	}
+	for r := range loop9 {
+		for c := range loop9 {
+			if givens[r][c] >= 0 && !a.Forced(int8(r), int8(c)) {
+				t.Fatalf("线索单元格 (%d,%d) 应该是固定的", r+1, c+1)
+			}
+		}
+	}
+	t.Logf("%d 个解，固定单元格 %d 个，求解 %d 次", count, a.ForcedCount(), a.SolverCalls)
+}
+
+func TestAnalyzeCandidatesWithoutCache(t *testing.T) {
+	puzzle, err := os.ReadFile("puzzles/hard-02.txt")
+	check(err)
+	for _, text := range []string{string(puzzle), ".........\n" + string(puzzle[10:])} {
+		s, trg := ParseSituation(text)
+		cached, _ := AnalyzeCandidates(s, trg)
+		uncached, _ := AnalyzeCandidatesWithCache(s, trg, nil)
+		if cached.Possible != uncached.Possible || uncached.Cache.Lookups != 0 {
+			t.Fatal("使用置换表的候选分析结果不同")
+		}
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"cmp"
 	"fmt"
 	"io"
 	"os"
@@ -65,9 +66,122 @@ func TestHardest1106_MT(t *testing.T) {
 	}).Run(t)
 }
 
+func TestHardest1106_DLX(t *testing.T) {
+	(&BenchmarkConfig{
+		InputFile: "assets/hardest_1106.txt",
+		Engine:    "dlx",
+	}).Run(t)
+}
+
+func TestHardest1106_SAT(t *testing.T) {
+	(&BenchmarkConfig{
+		InputFile: "assets/hardest_1106.txt",
+		Engine:    "sat",
+	}).Run(t)
+}
+
+func Test17Clue_Bits(t *testing.T) {
+	(&BenchmarkConfig{
+		InputFile: "assets/17_clue.txt",
+		Engine:    "bits",
+	}).Run(t)
+}
+
+func TestHardest1905_Bits(t *testing.T) {
+	(&BenchmarkConfig{
+		InputFile: "assets/hardest_1905_11.txt",
+		Engine:    "bits",
+	}).Run(t)
+}
+
+func TestHardest1106_Bits(t *testing.T) {
+	(&BenchmarkConfig{
+		InputFile: "assets/hardest_1106.txt",
+		Engine:    "bits",
+	}).Run(t)
+}
+
+func TestHardest1106_AdaptiveRules(t *testing.T) {
+	(&BenchmarkConfig{
+		InputFile:     "assets/hardest_1106.txt",
+		AdaptiveRules: true,
+	}).Run(t)
+}
+
+func TestHardest1106_Iterative(t *testing.T) {
+	(&BenchmarkConfig{
+		InputFile: "assets/hardest_1106.txt",
+		Iterative: true,
+	}).Run(t)
+}
+
+func BenchmarkSolve17Clue(b *testing.B) {
+	benchmarkSolveInto(b, "assets/17_clue.txt")
+}
+
+func BenchmarkSolveHardest1905(b *testing.B) {
+	benchmarkSolveInto(b, "assets/hardest_1905_11.txt")
+}
+
+func BenchmarkSolveHardest1106(b *testing.B) {
+	benchmarkSolveInto(b, "assets/hardest_1106.txt")
+}
+
+// benchmarkSolveInto 用同一个 PropagationSolver 依次求解文件中的谜题，每次迭代一个谜题。
+// 稳定状态下应报告 0 allocs/op。
+func benchmarkSolveInto(b *testing.B, filename string) {
+	lines := readPuzzleLines(openInput(filename))
+	ps := &PropagationSolver{}
+	var puzzle [9][9]int8
+	var solutions [2][9][9]int8
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := range b.N {
+		check(ParseCellsInto(&puzzle, lines[i%len(lines)]))
+		if ps.SolveInto(&puzzle, solutions[:]) != 1 {
+			b.Fatalf("puzzle %d: not unique", i%len(lines))
+		}
+	}
+}
+
+// TestSolveIntoAllocs 保证热路径不分配内存：解析、求解和输出解都复用调用者的缓冲区
+func TestSolveIntoAllocs(t *testing.T) {
+	lines := readPuzzleLines(openInput("assets/hardest_1905_11.txt"))[:100]
+	ps := &PropagationSolver{}
+	var puzzle [9][9]int8
+	var solutions [2][9][9]int8
+	solve := func(i int) {
+		check(ParseCellsInto(&puzzle, lines[i%len(lines)]))
+		if ps.SolveInto(&puzzle, solutions[:]) != 1 {
+			t.Fatalf("puzzle %d: not unique", i%len(lines))
+		}
+		if !isSolutionOf(&puzzle, &solutions[0]) {
+			t.Fatalf("puzzle %d: wrong solution", i%len(lines))
+		}
+	}
+	//预热：填充对象池，使 Queue 等缓冲区增长到足够大
+	for i := range lines {
+		solve(i)
+	}
+	i := 0
+	allocs := testing.AllocsPerRun(len(lines), func() {
+		solve(i)
+		i++
+	})
+	if allocs != 0 {
+		t.Errorf("SolveInto allocs per run = %v, want 0", allocs)
+	}
+}
+
 type BenchmarkConfig struct {
-	Parallel        int
-	GensApplyRules  int
+	Parallel       int
+	GensApplyRules int
+	AdaptiveRules  bool
+	Iterative      bool
+	//分支策略，见 NewBranchStrategy
+	Strategy string
+	//解题算法，见 NewSolver，空字符串使用 SudokuContext
+	Engine          string
 	InputFile       string
 	OutputFile      string
 	OverwriteOutput bool
@@ -133,6 +247,8 @@ func (cfg *BenchmarkConfig) Run(t *testing.T) {
 	printNamedValue("输出文件", "%s", cfg.OutputFile)
 	printNamedValue("CPU统计文件", "%s", cfg.PprofFile)
 	printNamedValue("线程数", "%d", cfg.Parallel)
+	printNamedValue("迭代搜索", "%v", cfg.Iterative)
+	printNamedValue("动态排除规则", "%v", cfg.AdaptiveRules)
 	printNamedValue("启动时间", "%s", startTime.Format("2006-01-02 15:04:05"))
 
 	getLine := func() ([]byte, bool) {
@@ -152,18 +268,58 @@ func (cfg *BenchmarkConfig) Run(t *testing.T) {
 		}
 	}
 
+	//Solver 不能并发使用，每个线程从池中取一个
+	var solverPool sync.Pool
+	if cfg.Engine != "" {
+		_, err := NewSolver(cfg.Engine)
+		check(err)
+		solverPool.New = func() any {
+			solver, _ := NewSolver(cfg.Engine)
+			return solver
+		}
+	}
+	printNamedValue("解题算法", "%s", cmp.Or(cfg.Engine, "default"))
+	strategy, err := NewBranchStrategy(cfg.Strategy, 1)
+	check(err)
+	printNamedValue("分支策略", "%s", cmp.Or(cfg.Strategy, "default"))
+
+	solve := func(line []byte) ([]*[9][9]int8, SolverStats) {
+		if cfg.Engine == "" {
+			s, trg := ParseSituationFromLine(line)
+			defer ReleaseSituation(s)
+			defer ReleaseTrigger(trg)
+			ctx := NewSudokuContext()
+			ctx.GensApplyRules = cfg.GensApplyRules
+			ctx.AdaptiveRules = cfg.AdaptiveRules
+			ctx.Iterative = cfg.Iterative
+			ctx.Strategy = strategy
+			ctx.Run(s, trg)
+			return ctx.solutions, SolverStats{
+				BranchCount:   ctx.branchCount,
+				EvalCount:     ctx.evalCount,
+				RulesDebranch: ctx.rulesDebranch,
+			}
+		}
+		puzzle, err := ParseCellsFromLine(line)
+		check(err)
+		solver := solverPool.Get().(Solver)
+		defer solverPool.Put(solver)
+		var solutions []*[9][9]int8
+		solver.Solve(puzzle, func(solution *[9][9]int8) bool {
+			cells := *solution
+			solutions = append(solutions, &cells)
+			return true
+		})
+		return solutions, solver.Stats()
+	}
+
 	proceed := func(line []byte) []byte {
-		s, trg := ParseSituationFromLine(line)
-		defer ReleaseSituation(s)
-		defer ReleaseTrigger(trg)
-		ctx := NewSudokuContext()
-		ctx.GensApplyRules = cfg.GensApplyRules
-		ctx.Run(s, trg)
+		solutions, stats := solve(line)
 
 		var solutionLine []byte
 
-		if len(ctx.solutions) == 1 {
-			solution := ctx.solutions[0]
+		if len(solutions) == 1 {
+			solution := solutions[0]
 			solutionLine = make([]byte, 82)
 			for r := range loop9 {
 				for c := range loop9 {
@@ -172,20 +328,20 @@ func (cfg *BenchmarkConfig) Run(t *testing.T) {
 			}
 			solutionLine[81] = '\n'
 		} else {
-			solutionLine = fmt.Appendf(nil, "%d solution(s)", len(ctx.solutions))
+			solutionLine = fmt.Appendf(nil, "%d solution(s)", len(solutions))
 		}
 
 		mtx.Lock()
 		puzzlesCount += 1
-		if len(ctx.solutions) == 1 {
+		if len(solutions) == 1 {
 			succCount++
 		}
-		for idx, numBranches := range ctx.branchCount {
+		for idx, numBranches := range stats.BranchCount {
 			branchCount[idx] += numBranches
 			sumBranch += numBranches
 		}
-		evalCount += ctx.evalCount
-		rulesDebranch += ctx.rulesDebranch
+		evalCount += stats.EvalCount
+		rulesDebranch += stats.RulesDebranch
 		mtx.Unlock()
 
 		return solutionLine
@@ -260,9 +416,3 @@ func textWidth(text string) int {
 	}
 	return w
 }
-
-func check(err error) {
-	if err != nil {
-		panic(err)
-	}
-}
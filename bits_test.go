@@ -0,0 +1,29 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestBitsCrossCheck(t *testing.T) {
+	oracle := NewDLXSolver()
+	for _, locked := range []bool{false, true} {
+		solver := &BitSolver{LockedCandidates: locked}
+		for _, file := range []string{"assets/17_clue.txt", "assets/hardest_1106.txt", "assets/hardest_1905_11.txt"} {
+			lines := readPuzzleLines(openInput(file))
+			for _, line := range lines[:100] {
+				puzzle, err := ParseCellsFromLine(line)
+				check(err)
+				crossCheckSolvers(t, solver, oracle, puzzle)
+			}
+		}
+
+		raw, err := os.ReadFile("puzzles/hard-02.txt")
+		check(err)
+		multi, _ := ParseSituation(".........\n" + string(raw[10:]))
+		crossCheckSolvers(t, solver, oracle, &multi.cells)
+
+		conflict, _ := ParseSituation("11.......")
+		crossCheckSolvers(t, solver, oracle, &conflict.cells)
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Board 是约束读取和排除候选数的局势，Constraint 只通过它访问局势。
+// Situation 设置了 VariantRules 后用 situationBoard 应用约束，排除经过 excludeOne，
+// 所以会触发唯一数、唯一位置，也会记录到 Trail 和复杂排除规则的标记；
+// Grid 是不规则区域和合体数独的局势，见 VariantSolver。
+type Board interface {
+	Layout() *Layout
+	// Get 返回单元格 i 填的数，-1 为未填
+	Get(i int) int8
+	// Candidates 返回单元格 i 的候选数掩码，已填的单元格只有所填的数
+	Candidates(i int) int16
+	// Exclude 从单元格 i 排除 n，返回是否有变化
+	Exclude(i int, n int8) bool
+	// fail 记录矛盾的原因
+	fail(format string, args ...any)
+}
+
+// VariantRules 是变体谜题在 Situation 上的规则：Layout 中行、列、宫以外的房和同伴，反马步等规则和覆盖层，
+// 以及谜题的其他约束。这样变体谜题也可以使用 SudokuContext 的迭代搜索、多线程搜索、分支策略和复杂排除规则。
+// Situation 的行、列、宫是固定的，所以只支持包含标准行、列、宫的 9*9 盘面，
+// 不规则区域和合体数独只能使用 VariantSolver。
+type VariantRules struct {
+	layout *Layout
+	//用 SetMoveRules、SetCellAttrs 设置到局势，不作为约束应用
+	moves *MoveRules
+	attrs *CellAttrs
+	//houses 是 layout 中行、列、宫以外的房的下标
+	houses []int
+	//extraPeers[r][c] 是 (r,c) 在行、列、宫以外的同伴，填数时排除同一个数
+	extraPeers [9][9][]RowCol
+	//extraHouses[r][c] 是包含 (r,c) 的额外的房在 layout.Houses 中的下标
+	extraHouses [9][9][]int
+	//nearHouses[r][c] 是与 (r,c) 所在的行、列、宫相交的额外的房，(r,c) 填数后这些房可能只剩一个位置可以填同一个数
+	nearHouses  [9][9][]int
+	constraints []Constraint
+}
+
+// NewVariantRules 返回谜题 vp 在 Situation 上的规则，盘面不是标准的 9*9 盘面时返回错误
+func NewVariantRules(vp *VariantPuzzle) (*VariantRules, error) {
+	l := vp.Layout()
+	if l.Rows != 9 || l.Cols != 9 || l.absent != nil {
+		return nil, fmt.Errorf("variant rules: gattai layouts are not supported by Situation")
+	}
+	standard := make(map[[9]int]bool)
+	for _, house := range StandardHouses() {
+		standard[sortedCells(house.Cells)] = true
+	}
+	v := &VariantRules{
+		layout:      l,
+		moves:       vp.moves,
+		attrs:       vp.Attrs,
+		constraints: vp.Constraints()[vp.ruleConstraints:],
+	}
+	found := 0
+	for h, house := range l.Houses {
+		if standard[sortedCells(house.Cells)] {
+			found++
+		} else {
+			v.houses = append(v.houses, h)
+		}
+	}
+	if found != 27 {
+		return nil, fmt.Errorf("variant rules: layouts without standard rows, columns and boxes are not supported by Situation")
+	}
+	for i, peers := range l.peers {
+		r, c := int8(i/9), int8(i%9)
+		b, _ := rcbp(r, c)
+		for _, j := range peers {
+			r0, c0 := int8(j/9), int8(j%9)
+			if b0, _ := rcbp(r0, c0); r0 != r && c0 != c && b0 != b {
+				v.extraPeers[r][c] = append(v.extraPeers[r][c], RowCol{r0, c0})
+			}
+		}
+	}
+	for _, h := range v.houses {
+		for _, i := range l.Houses[h].Cells {
+			v.extraHouses[i/9][i%9] = append(v.extraHouses[i/9][i%9], h)
+		}
+		for i := range 81 {
+			r, c := int8(i/9), int8(i%9)
+			b, _ := rcbp(r, c)
+			for _, j := range l.Houses[h].Cells {
+				r0, c0 := int8(j/9), int8(j%9)
+				if b0, _ := rcbp(r0, c0); r0 == r || c0 == c || b0 == b {
+					v.nearHouses[r][c] = append(v.nearHouses[r][c], h)
+					break
+				}
+			}
+		}
+	}
+	return v, nil
+}
+
+func sortedCells(cells [9]int) [9]int {
+	slices.Sort(cells[:])
+	return cells
+}
+
+// SetVariantRules 为局势启用变体规则，并对已填的数应用规则，反马步等规则和覆盖层同样设置到局势。
+// v 为 nil 时不做任何事。约束在 logicalEval 没有待填的数时应用。
+func (s *Situation) SetVariantRules(t *Trigger, v *VariantRules) {
+	if v == nil {
+		return
+	}
+	s.SetMoveRules(t, v.moves)
+	s.SetCellAttrs(t, v.attrs)
+	s.variant = v
+	for r := range int8(9) {
+		for c := range int8(9) {
+			if n := s.cells[r][c]; n >= 0 {
+				s.applyVariantSet(t, r, c, n)
+			}
+		}
+	}
+}
+
+// NewSituation 返回填入已知数并启用了变体规则的局势
+func (vp *VariantPuzzle) NewSituation() (*Situation, *Trigger, error) {
+	v, err := NewVariantRules(vp)
+	if err != nil {
+		return nil, nil, err
+	}
+	s, t := NewSituation(), NewTrigger()
+	s.SetVariantRules(t, v)
+	for i, n := range vp.Givens {
+		if n >= 0 {
+			s.Set(t, RCN(int8(i/9), int8(i%9), n))
+		}
+	}
+	return s, t, nil
+}
+
+// Clauses 返回 SATSolver 的额外子句：额外的房每个数恰好出现一次，额外的同伴不能填相同的数。
+// 约束、反马步等规则和覆盖层不转换为子句，有这些规则时返回错误。
+func (v *VariantRules) Clauses() ([][]int, error) {
+	if len(v.constraints) > 0 || v.moves != nil || v.attrs != nil {
+		return nil, fmt.Errorf("variant rules: constraints, move rules and overlay are not supported by SAT clauses")
+	}
+	var clauses [][]int
+	for r := range int8(9) {
+		for c := range int8(9) {
+			for _, rc := range v.extraPeers[r][c] {
+				if rc.Row*9+rc.Col > r*9+c {
+					clauses = append(clauses, AllDifferentClauses([]RowCol{{r, c}, rc})...)
+				}
+			}
+		}
+	}
+	for _, h := range v.houses {
+		var cells []RowCol
+		for _, i := range v.layout.Houses[h].Cells {
+			cells = append(cells, RowCol{int8(i / 9), int8(i % 9)})
+		}
+		clauses = append(clauses, houseExactlyOneClauses(cells)...)
+	}
+	return clauses, nil
+}
+
+// Run 在启用了变体规则的 Situation 上用 ctx 搜索谜题的解，每找到一个解调用一次 yield，解转换为谜题盘面上的 Grid。
+// yield 返回 false 表示停止搜索。返回找到的解的数量；盘面不是标准的 9*9 盘面时返回错误，需要使用 VariantSolver。
+func (vp *VariantPuzzle) Run(ctx *SudokuContext, yield func(g *Grid) bool) (int, error) {
+	s, t, err := vp.NewSituation()
+	if err != nil {
+		return 0, err
+	}
+	ctx.OnSolution = func(solution *[9][9]int8) bool {
+		return yield(vp.gridFromCells(solution))
+	}
+	defer func() { ctx.OnSolution = nil }()
+	return ctx.Run(s, t), nil
+}
+
+// gridFromCells 返回填入 cells 的局势，用于按谜题的盘面显示 Situation 的解
+func (vp *VariantPuzzle) gridFromCells(cells *[9][9]int8) *Grid {
+	g := NewGrid(vp.Layout())
+	for i := range 81 {
+		if n := cells[i/9][i%9]; n >= 0 {
+			g.Set(i, n)
+		}
+	}
+	return g
+}
+
+// applyVariantSet 在 (r,c) 填 n 之后，从额外的同伴排除 n，并检查额外的房中唯一可以填某个数的位置：
+// 包含 (r,c) 的房中 (r,c) 排除了其他数，相交的房中 Set 从同行、列、宫排除了 n
+func (s *Situation) applyVariantSet(t *Trigger, r, c, n int8) {
+	v := s.variant
+	for _, rc := range v.extraPeers[r][c] {
+		s.excludeOne(t, RCN(rc.Row, rc.Col, n))
+	}
+	for _, h := range v.extraHouses[r][c] {
+		for n0 := range int8(9) {
+			s.checkVariantHouse(t, h, n0)
+		}
+	}
+	for _, h := range v.nearHouses[r][c] {
+		s.checkVariantHouse(t, h, n)
+	}
+}
+
+// checkVariantHouse 检查额外的房 h 中可以填 n 的位置：只有一个时填入，没有时记录矛盾
+func (s *Situation) checkVariantHouse(t *Trigger, h int, n int8) {
+	house := &s.variant.layout.Houses[h]
+	place, places := -1, 0
+	for _, i := range house.Cells {
+		if s.cellExclude[n][i/9][i%9] == 0 {
+			place = i
+			places++
+		}
+	}
+	switch places {
+	case 0:
+		t.Conflicts = append(t.Conflicts, Conflict{
+			ConflictType: ConflictVariant,
+			RowColNum:    RCN(int8(house.Cells[0]/9), int8(house.Cells[0]%9), n),
+			Reason:       fmt.Sprintf("%s 没有单元格可以填 %d", house.Name, n+1),
+		})
+	case 1:
+		s.confirm(t, RCN(int8(place/9), int8(place%9), n))
+	}
+}
+
+// applyConstraints 反复应用变体约束，直到没有新的排除，或者有了待填的数、矛盾。返回是否有新的排除或矛盾。
+func (s *Situation) applyConstraints(t *Trigger) bool {
+	board := situationBoard{s, t}
+	changed := false
+	for t.confirms.Size() == 0 && len(t.Conflicts) == 0 {
+		round := false
+		for _, constraint := range s.variant.constraints {
+			if constraint.Propagate(board) {
+				round = true
+			}
+			if len(t.Conflicts) > 0 {
+				break
+			}
+		}
+		if !round {
+			break
+		}
+		changed = true
+	}
+	return changed
+}
+
+// situationBoard 使 Situation 实现 Board：排除经过 excludeOne，矛盾记录到 Trigger
+type situationBoard struct {
+	s *Situation
+	t *Trigger
+}
+
+func (b situationBoard) Layout() *Layout {
+	return b.s.variant.layout
+}
+
+func (b situationBoard) Get(i int) int8 {
+	return b.s.cells[i/9][i%9]
+}
+
+func (b situationBoard) Candidates(i int) int16 {
+	return ^b.s.numExcludeMask[i/9][i%9] & 511
+}
+
+func (b situationBoard) Exclude(i int, n int8) bool {
+	return b.s.excludeOne(b.t, RCN(int8(i/9), int8(i%9), n)) > 0
+}
+
+func (b situationBoard) fail(format string, args ...any) {
+	b.t.Conflicts = append(b.t.Conflicts, Conflict{
+		ConflictType: ConflictVariant,
+		Reason:       fmt.Sprintf(format, args...),
+	})
+}
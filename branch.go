@@ -0,0 +1,245 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// BranchStrategy 决定推理停止后在哪里分支、按什么顺序尝试候选项。
+// 不同的策略只影响分支数和演算次数，不影响解的集合。
+// Parallel 大于 1 时会被多个线程同时调用，实现不能修改自身状态。
+type BranchStrategy interface {
+	// ChooseBranch 返回局势 s 的分支候选项，这些候选项中恰好有一个属于正确的解。
+	// 返回的 BranchChoices 由调用者用 ReleaseBranchChoices 释放；返回 nil 表示没有可分支的单元格。
+	ChooseBranch(s *Situation) *BranchChoices
+}
+
+var branchStrategies = map[string]func(seed int64) BranchStrategy{
+	"default":    func(int64) BranchStrategy { return DefaultStrategy{} },
+	"mrv":        func(int64) BranchStrategy { return MRVStrategy{} },
+	"mrv-degree": func(int64) BranchStrategy { return MRVStrategy{Degree: true} },
+	"bivalue":    func(int64) BranchStrategy { return BivalueStrategy{} },
+	"digit":      func(int64) BranchStrategy { return DigitStrategy{} },
+	"random":     func(seed int64) BranchStrategy { return RandomStrategy{Seed: seed} },
+}
+
+// BranchStrategyNames 返回所有可用的分支策略名称
+func BranchStrategyNames() []string {
+	var names []string
+	for name := range branchStrategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewBranchStrategy 按名称创建分支策略，空名称代表 "default"。seed 只用于 "random"。
+func NewBranchStrategy(name string, seed int64) (BranchStrategy, error) {
+	if name == "" {
+		name = "default"
+	}
+	newStrategy, ok := branchStrategies[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown strategy %q, available: %v", name, BranchStrategyNames())
+	}
+	return newStrategy(seed), nil
+}
+
+// DefaultStrategy 即 ChooseBranchCell1：候选数最少，其次所在行、列、宫已填的数最少，再以散列挑选；
+// 双值单元格按 CompareNumInCell 决定先猜哪个数。
+type DefaultStrategy struct{}
+
+func (DefaultStrategy) ChooseBranch(s *Situation) *BranchChoices {
+	return s.ChooseBranchCell1()
+}
+
+// MRVStrategy 选择候选数最少（Minimum Remaining Values）的单元格，候选数按从小到大尝试。
+// Degree 为 true 时，候选数相同的单元格中选择未填同伴（同行、列、宫的其他单元格）最多的，
+// 否则选择行列顺序的第一个。
+type MRVStrategy struct {
+	Degree bool
+}
+
+func (x MRVStrategy) ChooseBranch(s *Situation) *BranchChoices {
+	r, c := s.chooseMRVCell(func(r, c int8) int {
+		if x.Degree {
+			return -s.unfilledPeers(r, c)
+		}
+		return 0
+	})
+	if r < 0 {
+		return nil
+	}
+	return s.cellChoices(r, c)
+}
+
+// BivalueStrategy 优先选择双值单元格，其中同伴里双值单元格最多的一个，
+// 这样的单元格猜错后更容易沿着双值链快速产生矛盾。没有双值单元格时与 MRV 相同。
+type BivalueStrategy struct{}
+
+func (BivalueStrategy) ChooseBranch(s *Situation) *BranchChoices {
+	r, c := s.chooseMRVCell(func(r, c int8) int {
+		if countTrueBits(s.numExcludeMask[r][c]) != 7 {
+			return 0
+		}
+		bivaluePeers := 0
+		s.forEachPeer(r, c, func(r0, c0 int8) {
+			if s.cells[r0][c0] == -1 && countTrueBits(s.numExcludeMask[r0][c0]) == 7 {
+				bivaluePeers++
+			}
+		})
+		return -bivaluePeers
+	})
+	if r < 0 {
+		return nil
+	}
+	return s.cellChoices(r, c)
+}
+
+// DigitStrategy 不选择单元格，而是选择可填位置最少的"行、列或宫 + 数字"，
+// 对该数字在这个区域内的每个可填位置分支。可填位置为 2 时即在隐性数对上分支。
+// 位置数相同时，单元格候选数更少的一方优先（平局时选单元格）。
+type DigitStrategy struct{}
+
+func (DigitStrategy) ChooseBranch(s *Situation) *BranchChoices {
+	cellR, cellC := s.chooseMRVCell(func(r, c int8) int { return 0 })
+	if cellR < 0 {
+		return nil
+	}
+	cellNums := 9 - int(countTrueBits(s.numExcludeMask[cellR][cellC]))
+
+	bestPlaces := cellNums
+	var bestN, bestKind, bestX int8
+	for n := range loop9 {
+		for x := range loop9 {
+			for kind, mask := range [3]int16{
+				s.rowExcludeMask[n][x], s.colExcludeMask[n][x], s.blockExcludeMask[n][x],
+			} {
+				//只剩一个位置的区域已经填了 n
+				places := 9 - int(countTrueBits(mask))
+				if places >= 2 && places < bestPlaces {
+					bestPlaces = places
+					bestN, bestKind, bestX = int8(n), int8(kind), int8(x)
+				}
+			}
+		}
+	}
+	if bestPlaces == cellNums {
+		return s.cellChoices(cellR, cellC)
+	}
+
+	result := NewBranchChoices()
+	for i := range loop9 {
+		var r, c int8
+		var mask int16
+		switch bestKind {
+		case 0:
+			r, c, mask = bestX, int8(i), s.rowExcludeMask[bestN][bestX]
+		case 1:
+			r, c, mask = int8(i), bestX, s.colExcludeMask[bestN][bestX]
+		default:
+			r, c = bestX/3*3+int8(i)/3, bestX%3*3+int8(i)%3
+			mask = s.blockExcludeMask[bestN][bestX]
+		}
+		if mask&(1<<i) == 0 {
+			result.Add(RCN(r, c, bestN))
+		}
+	}
+	return result
+}
+
+// RandomStrategy 在候选数最少的单元格中随机选择一个，并以随机顺序尝试候选数。
+// 随机数由 Seed 和局势本身散列得到，不保存状态，因此同一个 Seed 的结果可以重现，并且可以被多个线程同时使用。
+type RandomStrategy struct {
+	Seed int64
+}
+
+func (x RandomStrategy) ChooseBranch(s *Situation) *BranchChoices {
+	h := uint64(x.Seed)
+	for r := range loop9 {
+		for c := range loop9 {
+			h = splitmix64(h ^ uint64(s.cells[r][c]+1))
+		}
+	}
+	r, c := s.chooseMRVCell(func(r, c int8) int {
+		return int(splitmix64(h^uint64(r*9+c)) >> 33)
+	})
+	if r < 0 {
+		return nil
+	}
+	result := s.cellChoices(r, c)
+	for i := len(result.Choices) - 1; i > 0; i-- {
+		h = splitmix64(h)
+		j := int(h % uint64(i+1))
+		result.Choices[i], result.Choices[j] = result.Choices[j], result.Choices[i]
+	}
+	return result
+}
+
+func splitmix64(x uint64) uint64 {
+	x += 0x9E3779B97F4A7C15
+	x = (x ^ x>>30) * 0xBF58476D1CE4E5B9
+	x = (x ^ x>>27) * 0x94D049BB133111EB
+	return x ^ x>>31
+}
+
+// chooseMRVCell 返回候选数最少的未填单元格，候选数相同时 score 小的优先，再相同时行列顺序靠前的优先。
+// 没有未填单元格时返回 (-1, -1)。
+func (s *Situation) chooseMRVCell(score func(r, c int8) int) (int8, int8) {
+	bestR, bestC := int8(-1), int8(-1)
+	bestExcludes, bestScore := int8(-1), 0
+	for r := range int8(9) {
+		for c := range int8(9) {
+			if s.cells[r][c] != -1 {
+				continue
+			}
+			excludes := countTrueBits(s.numExcludeMask[r][c])
+			if excludes < bestExcludes {
+				continue
+			}
+			cellScore := score(r, c)
+			if excludes > bestExcludes || cellScore < bestScore {
+				bestR, bestC, bestExcludes, bestScore = r, c, excludes, cellScore
+			}
+		}
+	}
+	return bestR, bestC
+}
+
+// cellChoices 返回单元格 (r,c) 的所有候选数，从小到大
+func (s *Situation) cellChoices(r, c int8) *BranchChoices {
+	result := NewBranchChoices()
+	for n := range int8(9) {
+		if s.numExcludeMask[r][c]&(1<<n) == 0 {
+			result.Add(RCN(r, c, n))
+		}
+	}
+	return result
+}
+
+// forEachPeer 对与 (r,c) 同行、同列或同宫的 20 个单元格调用 f
+func (s *Situation) forEachPeer(r, c int8, f func(r0, c0 int8)) {
+	for i := range int8(9) {
+		if i != c {
+			f(r, i)
+		}
+		if i != r {
+			f(i, c)
+		}
+		r0, c0 := r/3*3+i/3, c/3*3+i%3
+		if r0 != r && c0 != c {
+			f(r0, c0)
+		}
+	}
+}
+
+// unfilledPeers 返回与 (r,c) 同行、同列或同宫的未填单元格数
+func (s *Situation) unfilledPeers(r, c int8) int {
+	count := 0
+	s.forEachPeer(r, c, func(r0, c0 int8) {
+		if s.cells[r0][c0] == -1 {
+			count++
+		}
+	})
+	return count
+}
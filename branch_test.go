@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestBranchStrategies(t *testing.T) {
+	raw, err := os.ReadFile("puzzles/hard-02.txt")
+	check(err)
+	multi := ".........\n" + string(raw[10:])
+	lines := readPuzzleLines(openInput("assets/hardest_1106.txt"))[:100]
+
+	for _, name := range BranchStrategyNames() {
+		strategy, err := NewBranchStrategy(name, 7)
+		check(err)
+
+		s, trg := ParseSituation(multi)
+		givens := s.cells
+		ctx := &SudokuContext{Strategy: strategy}
+		if count := ctx.Run(s, trg); count != 292 {
+			t.Fatalf("%s: 找到 %d 个解，应为 292 个", name, count)
+		}
+		seen := make(map[[9][9]int8]bool)
+		for _, solution := range ctx.solutions {
+			if !isSolutionOf(&givens, solution) || seen[*solution] {
+				t.Fatalf("%s: 错误或重复的解", name)
+			}
+			seen[*solution] = true
+		}
+
+		evalCount := 0
+		for _, line := range lines {
+			s, trg := ParseSituationFromLine(line)
+			expected := NewSudokuContext()
+			expected.Run(DuplicateSituation(s), DuplicateTrigger(trg))
+			ctx := &SudokuContext{Strategy: strategy}
+			if ctx.Run(s, trg) != 1 || *ctx.solutions[0] != *expected.solutions[0] {
+				t.Fatalf("%s: 结果与默认策略不同：%s", name, line)
+			}
+			evalCount += ctx.evalCount
+		}
+		t.Logf("%-10s 演算次数 %d", name, evalCount)
+	}
+
+	if _, err := NewBranchStrategy("nonexistent", 0); err == nil {
+		t.Fatal("未知的分支策略应返回错误")
+	}
+}
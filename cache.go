@@ -0,0 +1,178 @@
+package main
+
+import "container/list"
+
+// zobristKeys[r][c][n] 是单元格(r,c)填 n 的随机键，见 Situation.Hash
+var zobristKeys = func() (keys [9][9][9]uint64) {
+	x := uint64(0x5EED)
+	for r := range loop9 {
+		for c := range loop9 {
+			for n := range loop9 {
+				x = splitmix64(x)
+				keys[r][c][n] = x
+			}
+		}
+	}
+	return
+}()
+
+const (
+	//每个缓存项最多保存的解的数量，解更多的局势不缓存
+	cacheMaxSolutions = 8
+)
+
+// TranspositionCache 是已演算局势的有界 LRU 缓存（置换表），以 Situation.Hash 为键。
+//
+// 已填的数相同的局势，解也相同（排除信息都是由已填的数推理得到的），所以可以复用之前的结果：
+// 矛盾的局势直接返回无解，已知全部解的局势直接输出这些解，找到一个解即停止时，已知至少一个解的局势直接输出这个解。
+//
+// 在一次搜索中，不同分支已填的数总有不同，同一个局势不会出现两次；
+// 缓存用于对同一个谜题的多次搜索，例如 AnalyzeCandidates 对每个候选数的试探。
+// 只用于 recurseEval，不能并发使用：Parallel 大于 1 或 Iterative 时不能使用，见 SudokuContext.Validate。
+type TranspositionCache struct {
+	capacity int
+	entries  map[uint64]*list.Element
+	//最近使用的在前
+	lru   *list.List
+	stats CacheStats
+}
+
+// CacheStats 是 TranspositionCache 的统计
+type CacheStats struct {
+	//查询次数
+	Lookups int
+	//命中次数
+	Hits int
+	//保存次数
+	Stores int
+	//因超出容量被淘汰的数量
+	Evictions int
+}
+
+// HitRate 返回命中率
+func (st CacheStats) HitRate() float64 {
+	if st.Lookups == 0 {
+		return 0
+	}
+	return float64(st.Hits) / float64(st.Lookups)
+}
+
+type cacheEntry struct {
+	hash  uint64
+	cells [9][9]int8
+	//complete 为 true 时 count 是局势全部解的数量，否则只知道至少有 count 个解
+	complete bool
+	count    int
+	//局势的解，最多 cacheMaxSolutions 个
+	solutions [][9][9]int8
+}
+
+// NewTranspositionCache 创建最多保存 capacity 个局势的缓存
+func NewTranspositionCache(capacity int) *TranspositionCache {
+	return &TranspositionCache{
+		capacity: capacity,
+		entries:  make(map[uint64]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+func (tc *TranspositionCache) Stats() CacheStats {
+	return tc.stats
+}
+
+func (tc *TranspositionCache) Len() int {
+	return tc.lru.Len()
+}
+
+// get 返回与局势 s 已填的数完全相同的缓存项，没有则返回 nil
+func (tc *TranspositionCache) get(s *Situation) *cacheEntry {
+	elem, ok := tc.entries[s.Hash()]
+	if !ok {
+		return nil
+	}
+	entry := elem.Value.(*cacheEntry)
+	if entry.cells != s.cells {
+		//散列冲突
+		return nil
+	}
+	tc.lru.MoveToFront(elem)
+	return entry
+}
+
+// put 保存局势 s 的搜索结果。已有的完整结果不会被不完整的结果覆盖。
+func (tc *TranspositionCache) put(s *Situation, complete bool, count int, solutions [][9][9]int8) {
+	if tc.capacity <= 0 {
+		return
+	}
+	hash := s.Hash()
+	if elem, ok := tc.entries[hash]; ok {
+		old := elem.Value.(*cacheEntry)
+		if old.cells == s.cells && old.complete && !complete {
+			tc.lru.MoveToFront(elem)
+			return
+		}
+		tc.lru.Remove(elem)
+		delete(tc.entries, hash)
+	}
+	if tc.lru.Len() >= tc.capacity {
+		oldest := tc.lru.Back()
+		tc.lru.Remove(oldest)
+		delete(tc.entries, oldest.Value.(*cacheEntry).hash)
+		tc.stats.Evictions++
+	}
+	tc.entries[hash] = tc.lru.PushFront(&cacheEntry{
+		hash:      hash,
+		cells:     s.cells,
+		complete:  complete,
+		count:     count,
+		solutions: append([][9][9]int8(nil), solutions...),
+	})
+	tc.stats.Stores++
+}
+
+// lookupCache 查询局势 s 的缓存，可以直接使用时输出缓存的解，返回解的数量和 true
+func (ctx *SudokuContext) lookupCache(s *Situation) (int, bool) {
+	ctx.Cache.stats.Lookups++
+	entry := ctx.Cache.get(s)
+	if entry == nil {
+		return 0, false
+	}
+	var solutions [][9][9]int8
+	switch {
+	case entry.complete && entry.count == 0:
+	case ctx.StopAtFirstSolution && len(entry.solutions) > 0:
+		solutions = entry.solutions[:1]
+		if !entry.complete || entry.count > 1 {
+			ctx.truncated = true
+		}
+	case entry.complete && len(entry.solutions) == entry.count:
+		solutions = entry.solutions
+	default:
+		return 0, false
+	}
+	ctx.Cache.stats.Hits++
+	count := 0
+	for i := range solutions {
+		ctx.found = append(ctx.found, solutions[i])
+		ctx.addSolutionCells(&solutions[i])
+		count++
+		if ctx.stopped {
+			break
+		}
+	}
+	return count, true
+}
+
+// storeCache 保存局势 s 的搜索结果，foundStart 是开始搜索 s 时 ctx.found 的长度
+func (ctx *SudokuContext) storeCache(s *Situation, complete bool, count, foundStart int) {
+	found := ctx.found[foundStart:]
+	if count > cacheMaxSolutions {
+		//包含 s 的局势的解更多，也不会缓存，不需要再记录这些解
+		ctx.found = ctx.found[:foundStart]
+		return
+	}
+	if len(found) != count {
+		return
+	}
+	ctx.Cache.put(s, complete, count, found)
+}
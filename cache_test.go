@@ -0,0 +1,146 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func zobristOf(cells *[9][9]int8) uint64 {
+	var hash uint64
+	for r := range loop9 {
+		for c := range loop9 {
+			if n := cells[r][c]; n >= 0 {
+				hash ^= zobristKeys[r][c][n]
+			}
+		}
+	}
+	return hash
+}
+
+func TestZobristHash(t *testing.T) {
+	line := readPuzzleLines(openInput("assets/hardest_1106.txt"))[0]
+	s, trg := ParseSituationFromLine(line)
+	trail := &Trail{}
+	trg.trail = trail
+	mark := trail.Mark(s)
+	before := s.Hash()
+	NewSudokuContext().logicalEval(s, trg)
+	if s.Hash() != zobristOf(&s.cells) || s.Hash() == before {
+		t.Fatal("填数后散列不正确")
+	}
+	trail.Undo(s, mark)
+	if s.Hash() != before || s.Hash() != zobristOf(&s.cells) {
+		t.Fatal("撤销后散列不正确")
+	}
+
+	//以不同的顺序填入相同的数，散列相同
+	reversed := NewSituation()
+	for i := 80; i >= 0; i-- {
+		if n := line[i]; n >= '1' && n <= '9' {
+			reversed.Set(NewTrigger(), RCN(int8(i/9), int8(i%9), int8(n-'1')))
+		}
+	}
+	if reversed.Hash() != before {
+		t.Fatal("相同的局势散列不同")
+	}
+}
+
+func TestTranspositionCache(t *testing.T) {
+	raw, err := os.ReadFile("puzzles/hard-02.txt")
+	check(err)
+	s, trg := ParseSituation(".........\n" + string(raw[10:]))
+	//按其中一个解补充线索，直到只剩少量的解
+	var solutions []*[9][9]int8
+	for {
+		ctx := NewSudokuContext()
+		ctx.Run(DuplicateSituation(s), DuplicateTrigger(trg))
+		solutions = ctx.solutions
+		if len(solutions) <= cacheMaxSolutions {
+			break
+		}
+		for r := range int8(9) {
+			if s.cells[r][0] == -1 {
+				s.Set(trg, RCN(r, 0, solutions[0][r][0]))
+				break
+			}
+		}
+	}
+	if len(solutions) < 2 {
+		t.Fatalf("测试谜题应该有多个解，实际 %d 个", len(solutions))
+	}
+
+	cache := NewTranspositionCache(1024)
+	for i := range 2 {
+		ctx := &SudokuContext{Cache: cache}
+		if count := ctx.Run(DuplicateSituation(s), DuplicateTrigger(trg)); count != len(solutions) {
+			t.Fatalf("第 %d 次找到 %d 个解，应为 %d 个", i+1, count, len(solutions))
+		}
+		for j, solution := range ctx.solutions {
+			if *solution != *solutions[j] {
+				t.Fatalf("第 %d 次的解与不使用缓存时不同", i+1)
+			}
+		}
+		if i == 1 && ctx.branchCount != [10]int{} {
+			t.Fatal("第二次搜索应该直接使用缓存的结果")
+		}
+	}
+	if st := cache.Stats(); st.Hits != 1 || st.Stores == 0 {
+		t.Fatalf("缓存统计不正确：%+v", st)
+	}
+
+	//逐个产生解时，缓存的解同样交给 OnSolution
+	enum := &SudokuContext{Cache: cache}
+	var enumerated [][9][9]int8
+	for solution := range enum.Solutions(DuplicateSituation(s), DuplicateTrigger(trg)) {
+		enumerated = append(enumerated, *solution)
+	}
+	if len(enumerated) != len(solutions) || enumerated[0] != *solutions[0] || enum.branchCount != [10]int{} {
+		t.Fatalf("逐个产生解时应直接使用缓存的 %d 个解，实际 %d 个", len(solutions), len(enumerated))
+	}
+
+	if (&SudokuContext{Cache: cache, Iterative: true}).Validate() == nil {
+		t.Fatal("迭代搜索不能使用缓存")
+	}
+
+	first := &SudokuContext{Cache: cache, StopAtFirstSolution: true}
+	if first.Run(DuplicateSituation(s), DuplicateTrigger(trg)) != 1 {
+		t.Fatal("找到一个解即停止时应只输出缓存的第一个解")
+	}
+
+	small := NewTranspositionCache(2)
+	for r := range int8(3) {
+		s2 := NewSituation()
+		s2.Set(NewTrigger(), RCN(r, 0, 0))
+		small.put(s2, true, 0, nil)
+	}
+	if small.Len() != 2 || small.Stats().Evictions != 1 {
+		t.Fatal("超出容量时应淘汰最久没有使用的局势")
+	}
+}
+
+// 找到一个解即停止的搜索只得到部分的解，共用缓存的完整搜索不能把它们当作完整的结果
+func TestTranspositionCacheFirstSolution(t *testing.T) {
+	raw, err := os.ReadFile("puzzles/hard-02.txt")
+	check(err)
+	puzzle := ".........\n" + string(raw[10:])
+	ctx := NewSudokuContext()
+	expected := ctx.Run(ParseSituation(puzzle))
+	if expected <= cacheMaxSolutions {
+		t.Fatalf("测试谜题应该有较多的解，实际 %d 个", expected)
+	}
+
+	cache := NewTranspositionCache(4096)
+	for _, s := range ctx.solutions[:expected/2] {
+		//从不同的局势开始找第一个解，让缓存中留下各个子树的部分结果
+		s2, trg := ParseSituation(puzzle)
+		s2.Set(trg, RCN(0, 0, s[0][0]))
+		(&SudokuContext{Cache: cache, StopAtFirstSolution: true}).Run(s2, trg)
+	}
+	first := &SudokuContext{Cache: cache, StopAtFirstSolution: true}
+	if first.Run(ParseSituation(puzzle)) != 1 {
+		t.Fatal("找到一个解即停止时应只有一个解")
+	}
+	if count := (&SudokuContext{Cache: cache}).Run(ParseSituation(puzzle)); count != expected {
+		t.Fatalf("共用缓存时找到 %d 个解，应为 %d 个", count, expected)
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+)
+
+// 一个3元素的全部6种排列
+var perms3 = [6][3]int8{
+	{0, 1, 2}, {0, 2, 1}, {1, 0, 2}, {1, 2, 0}, {2, 0, 1}, {2, 1, 0},
+}
+
+// 保持栈（宫所在的3列）结构的全部 6^4 = 1296 种列排列
+var stackPerms = func() [][9]int8 {
+	perms := make([][9]int8, 0, 6*6*6*6)
+	for _, sp := range perms3 {
+		for _, p0 := range perms3 {
+			for _, p1 := range perms3 {
+				for _, p2 := range perms3 {
+					inner := [3][3]int8{p0, p1, p2}
+					var perm [9]int8
+					for S := range loop3 {
+						for i := range loop3 {
+							perm[S*3+i] = sp[S]*3 + inner[S][i]
+						}
+					}
+					perms = append(perms, perm)
+				}
+			}
+		}
+	}
+	return perms
+}()
+
+// canonSearch 用于求字典序最小的等价局面
+// 比较时空单元格视为0，数字 n 视为 n+1，所以空单元格会尽量排在前面
+type canonSearch struct {
+	src       *[9][9]int8
+	transpose bool
+	cols      [9]int8
+
+	rows     [9]int8
+	usedRows int16
+
+	//best[r][c] 当前最优结果，10 代表未确定（比任何值都大）
+	best   [9][9]int8
+	bestTf Transform
+}
+
+// Canonicalize 返回 cells 在全部数独等价变换下字典序最小的形式，以及产生这个形式的变换
+// 即 tf.ApplyCells(cells) == canon
+func Canonicalize(cells *[9][9]int8) (canon *[9][9]int8, tf Transform) {
+	cs := &canonSearch{}
+	for r := range loop9 {
+		for c := range loop9 {
+			cs.best[r][c] = 10
+		}
+	}
+	var transposed [9][9]int8
+	for r := range loop9 {
+		for c := range loop9 {
+			transposed[c][r] = cells[r][c]
+		}
+	}
+	for _, transpose := range []bool{false, true} {
+		cs.transpose = transpose
+		cs.src = cells
+		if transpose {
+			cs.src = &transposed
+		}
+		for _, cols := range stackPerms {
+			cs.cols = cols
+			var labels [9]int8
+			for i := range labels {
+				labels[i] = -1
+			}
+			cs.searchRow(0, labels, 0)
+		}
+	}
+
+	canon = new([9][9]int8)
+	for r := range loop9 {
+		for c := range loop9 {
+			canon[r][c] = cs.best[r][c] - 1
+		}
+	}
+	return canon, cs.bestTf
+}
+
+// searchRow 选择结果的第 k 行来自哪一行
+// labels[n] 是原数字 n 的新编号（-1 代表未编号），按首次出现的顺序编号使结果最小
+func (cs *canonSearch) searchRow(k int, labels [9]int8, nextLabel int8) {
+	if k == 9 {
+		cs.recordBest(labels, nextLabel)
+		return
+	}
+	var tmpArray [9]int8
+	candidates := tmpArray[:0]
+	if k%3 == 0 {
+		for r := range loop9 {
+			if cs.usedRows&(07<<(r/3*3)) == 0 {
+				candidates = append(candidates, int8(r))
+			}
+		}
+	} else {
+		band := cs.rows[k-1] / 3
+		for i := range loop3 {
+			r := band*3 + int8(i)
+			if cs.usedRows&(1<<r) == 0 {
+				candidates = append(candidates, r)
+			}
+		}
+	}
+
+	for _, r := range candidates {
+		rowLabels := labels
+		rowNext := nextLabel
+		var values [9]int8
+		for c, c0 := range cs.cols {
+			n := cs.src[r][c0]
+			if n < 0 {
+				continue
+			}
+			if rowLabels[n] < 0 {
+				rowLabels[n] = rowNext
+				rowNext++
+			}
+			values[c] = rowLabels[n] + 1
+		}
+
+		cmp := 0
+		for c := range loop9 {
+			if values[c] != cs.best[k][c] {
+				if values[c] < cs.best[k][c] {
+					cmp = -1
+				} else {
+					cmp = 1
+				}
+				break
+			}
+		}
+		if cmp > 0 {
+			continue
+		}
+		if cmp < 0 {
+			cs.best[k] = values
+			for k1 := k + 1; k1 < 9; k1++ {
+				for c := range loop9 {
+					cs.best[k1][c] = 10
+				}
+			}
+		}
+
+		cs.rows[k] = r
+		cs.usedRows |= 1 << r
+		cs.searchRow(k+1, rowLabels, rowNext)
+		cs.usedRows &^= 1 << r
+	}
+}
+
+func (cs *canonSearch) recordBest(labels [9]int8, nextLabel int8) {
+	tf := Transform{
+		Transpose: cs.transpose,
+		Rows:      cs.rows,
+		Cols:      cs.cols,
+	}
+	//没有出现的数字按从小到大继续编号
+	for n := range loop9 {
+		if labels[n] < 0 {
+			labels[n] = nextLabel
+			nextLabel++
+		}
+	}
+	tf.Nums = labels
+	cs.bestTf = tf
+}
+
+// CanonicalLine 返回81字符谜题的标准形式，空单元格用 '.' 表示
+func CanonicalLine(line []byte) ([]byte, Transform, error) {
+	cells, err := ParseCellsFromLine(line)
+	if err != nil {
+		return nil, Transform{}, err
+	}
+	canon, tf := Canonicalize(cells)
+	return FormatCellsLine(canon), tf, nil
+}
+
+// ParseCellsFromLine 解析不换行的81个字符，'1'~'9' 代表数字，其他字符代表空单元格
+func ParseCellsFromLine(line []byte) (*[9][9]int8, error) {
+	cells := new([9][9]int8)
+	if err := ParseCellsInto(cells, line); err != nil {
+		return nil, err
+	}
+	return cells, nil
+}
+
+// ParseCellsInto 与 ParseCellsFromLine 相同，但写入调用者提供的 cells，不分配内存
+func ParseCellsInto(cells *[9][9]int8, line []byte) error {
+	if len(line) != 81 {
+		return fmt.Errorf("invalid puzzle line length %d", len(line))
+	}
+	for i, ch := range line {
+		n := int8(-1)
+		if ch >= '1' && ch <= '9' {
+			n = int8(ch - '1')
+		}
+		cells[i/9][i%9] = n
+	}
+	return nil
+}
+
+// FormatCellsLine 把单元格输出为不换行的81个字符，空单元格用 '.' 表示
+func FormatCellsLine(cells *[9][9]int8) []byte {
+	line := make([]byte, 81)
+	for r := range loop9 {
+		for c := range loop9 {
+			ch := byte('.')
+			if n := cells[r][c]; n >= 0 {
+				ch = byte('1' + n)
+			}
+			line[r*9+c] = ch
+		}
+	}
+	return line
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestCanonicalizeInvariant(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	lines := readPuzzleLines(openInput("assets/hardest_1106.txt"))
+	for _, line := range lines[:20] {
+		canon, tf, err := CanonicalLine(line)
+		check(err)
+		cells, _ := ParseCellsFromLine(line)
+		if applied := FormatCellsLine(tf.ApplyCells(cells)); !bytes.Equal(applied, canon) {
+			t.Fatalf("变换不能得到标准形式：%s -> %s != %s", line, applied, canon)
+		}
+		if bytes.Compare(bytes.ReplaceAll(canon, []byte("."), []byte("0")),
+			bytes.ReplaceAll(line, []byte("."), []byte("0"))) > 0 {
+			t.Fatalf("标准形式不是最小：%s", canon)
+		}
+		for range 5 {
+			rtf := RandomTransform(rnd)
+			line2 := FormatCellsLine(rtf.ApplyCells(cells))
+			canon2, _, err := CanonicalLine(line2)
+			check(err)
+			if !bytes.Equal(canon, canon2) {
+				t.Fatalf("等价谜题的标准形式不同：%s %s", canon, canon2)
+			}
+		}
+	}
+}
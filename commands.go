@@ -0,0 +1,481 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"slices"
+	"time"
+)
+
+const MsgUsageCanon = `使用方法：
+
+gosudoku canon [选项] <file> 输出文件中每个谜题的标准形式
+gosudoku canon [选项]        从标准输入获取谜题
+
+谜题可以是每行81个字符，也可以是9行的单个谜题。
+
+`
+
+// runCanon 执行 canon 命令：计算谜题的标准形式，或按标准形式去重
+func runCanon(args []string) {
+	fs := flag.NewFlagSet("canon", flag.ExitOnError)
+	dedup := fs.Bool("dedup", false, "按标准形式去重，输出每类谜题第一次出现的原文")
+	showTransform := fs.Bool("transform", false, "同时输出从原谜题到标准形式的变换")
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, MsgUsageCanon)
+		fs.PrintDefaults()
+	}
+	check(fs.Parse(args))
+
+	lines := readPuzzleLines(openInput(fs.Arg(0)))
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+
+	seen := make(map[string]bool)
+	for _, line := range lines {
+		canon, tf, err := CanonicalLine(line)
+		check(err)
+		if *dedup {
+			if seen[string(canon)] {
+				continue
+			}
+			seen[string(canon)] = true
+			out.Write(line)
+		} else {
+			out.Write(canon)
+		}
+		if *showTransform {
+			fmt.Fprintf(out, " %s", tf)
+		}
+		out.WriteByte('\n')
+	}
+	if *dedup {
+		fmt.Fprintf(os.Stderr, "谜题 %d 个，去重后 %d 个\n", len(lines), len(seen))
+	}
+}
+
+// openInput 打开文件，文件名为空时使用标准输入
+func openInput(filename string) io.Reader {
+	if filename == "" {
+		return os.Stdin
+	}
+	raw, err := os.ReadFile(filename)
+	check(err)
+	return bytes.NewReader(raw)
+}
+
+// readPuzzleLines 读取所有81字符的谜题行，其他行忽略（如 # 开头的注释）。
+// 如果没有81字符的行，把全部输入当作一个9行的谜题，不支持覆盖层。
+func readPuzzleLines(input io.Reader) [][]byte {
+	raw, err := io.ReadAll(input)
+	check(err)
+	var lines [][]byte
+	for _, line := range bytes.Split(raw, []byte("\n")) {
+		line = bytes.TrimRight(line, "\r")
+		if len(line) == 81 {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > 0 {
+		return lines
+	}
+
+	puzzle, attrs, err := SplitCellAttrs(string(raw))
+	check(err)
+	if attrs != nil {
+		//标准形式、变换和测试集都只处理已填的数，覆盖层在行列置换后也不再成立
+		check(fmt.Errorf("overlay is only supported when solving a single puzzle"))
+	}
+	s, t := ParseSituation(puzzle)
+	defer ReleaseSituation(s)
+	defer ReleaseTrigger(t)
+	return [][]byte{FormatCellsLine(&s.cells)}
+}
+
+// parseOverlayPuzzle 解析9行的谜题，谜题之后可以有覆盖层，见 SplitCellAttrs
+func parseOverlayPuzzle(raw string) (*Situation, *Trigger) {
+	puzzle, attrs, err := SplitCellAttrs(raw)
+	check(err)
+	s, t := ParseSituation(puzzle)
+	s.SetCellAttrs(t, attrs)
+	return s, t
+}
+
+const MsgUsageEnum = `使用方法：
+
+gosudoku enum [选项] <file> 逐个输出谜题的解，每行81个字符
+gosudoku enum [选项]        从标准输入获取谜题
+
+`
+
+// runEnum 执行 enum 命令：边搜索边输出所有解，或随机抽取解
+func runEnum(args []string) {
+	fs := flag.NewFlagSet("enum", flag.ExitOnError)
+	limit := fs.Int("limit", 0, "最多输出N个解，0 表示不限制")
+	sample := fs.Int("sample", 0, "随机抽取N个解（每次使用随机分支顺序重新搜索，可能重复）")
+	seed := fs.Int64("seed", 0, "随机种子，0 表示使用当前时间")
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, MsgUsageEnum)
+		fs.PrintDefaults()
+	}
+	check(fs.Parse(args))
+
+	raw, err := io.ReadAll(openInput(fs.Arg(0)))
+	check(err)
+	s, t := parseOverlayPuzzle(string(raw))
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+
+	if *sample > 0 {
+		if *seed == 0 {
+			*seed = time.Now().UnixNano()
+		}
+		rnd := rand.New(rand.NewSource(*seed))
+		for range *sample {
+			solution, ok := SampleSolution(DuplicateSituation(s), DuplicateTrigger(t), rnd)
+			if !ok {
+				fmt.Fprintln(os.Stderr, "无解")
+				return
+			}
+			out.Write(FormatCellsLine(solution))
+			out.WriteByte('\n')
+		}
+		return
+	}
+
+	ctx := NewSudokuContext()
+	count := 0
+	for solution := range ctx.Solutions(s, t) {
+		out.Write(FormatCellsLine(solution))
+		out.WriteByte('\n')
+		count++
+		if count == *limit {
+			break
+		}
+	}
+	fmt.Fprintf(os.Stderr, "输出了 %d 个解\n", count)
+}
+
+const MsgUsageBackbone = `使用方法：
+
+gosudoku backbone <file> 分析谜题所有解中每个单元格可能的数字，以及所有解都相同的单元格
+gosudoku backbone        从标准输入获取谜题
+
+`
+
+// runBackbone 执行 backbone 命令：输出所有解的候选数网格，不需要列举全部解
+func runBackbone(args []string) {
+	fs := flag.NewFlagSet("backbone", flag.ExitOnError)
+	cacheSize := fs.Int("cache", analyzeCacheSize, "置换表最多保存的局势数，0 表示不使用")
+	//写在 backbone 之前的 -stat 同样有效
+	showStat := fs.Bool("stat", *flagShowStat, "显示运算统计信息和置换表命中率")
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, MsgUsageBackbone)
+		fs.PrintDefaults()
+	}
+	check(fs.Parse(args))
+
+	raw, err := io.ReadAll(openInput(fs.Arg(0)))
+	check(err)
+	s, t := parseOverlayPuzzle(string(raw))
+
+	startTime := time.Now()
+	var cache *TranspositionCache
+	if *cacheSize > 0 {
+		cache = NewTranspositionCache(*cacheSize)
+	}
+	a, ok := AnalyzeCandidatesWithCache(s, t, cache)
+	dur := time.Since(startTime)
+	if !ok {
+		s.Show("无解", -1, -1)
+		return
+	}
+	ShowCandidates(&a.Possible, "所有解中每个单元格可能的数字")
+	fmt.Printf("所有解都相同的单元格：%d\n", a.ForcedCount())
+	if *showStat {
+		fmt.Printf("总耗时：%v\n", dur)
+		fmt.Printf("求解次数：%d\n", a.SolverCalls)
+		fmt.Printf("置换表命中率：%.1f%% (%d/%d)\n", a.Cache.HitRate()*100, a.Cache.Hits, a.Cache.Lookups)
+	}
+}
+
+const MsgUsageTune = `使用方法：
+
+gosudoku tune [选项] <file> 在文件的谜题上搜索分支启发式的参数
+gosudoku tune [选项]        默认使用 assets/hardest_1106.txt
+
+谜题随机分成训练集和验证集：在训练集上搜索参数，再在验证集上与默认参数比较，避免只对训练集有效。
+
+`
+
+// runTune 执行 tune 命令：在训练集上搜索 HeuristicParams，在验证集上报告结果
+func runTune(args []string) {
+	fs := flag.NewFlagSet("tune", flag.ExitOnError)
+	trainSize := fs.Int("train", 150, "训练集谜题数")
+	testSize := fs.Int("test", 150, "验证集谜题数")
+	iterations := fs.Int("iters", 40, "搜索轮数")
+	objective := fs.String("objective", "branches", "优化目标：branches 总分支数，time 耗时")
+	seed := fs.Int64("seed", 1, "随机种子，用于划分谜题和搜索")
+	one := fs.Bool("one", *flagStopAtFirstSolution, "找到一个解即停止，这时才会搜索 compare-nums 和 compare-seed")
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, MsgUsageTune)
+		fs.PrintDefaults()
+	}
+	check(fs.Parse(args))
+	if *objective != "branches" && *objective != "time" {
+		check(fmt.Errorf("unknown objective %q", *objective))
+	}
+
+	filename := fs.Arg(0)
+	if filename == "" {
+		filename = "assets/hardest_1106.txt"
+	}
+	lines := readPuzzleLines(openInput(filename))
+	rnd := rand.New(rand.NewSource(*seed))
+	rnd.Shuffle(len(lines), func(i, j int) { lines[i], lines[j] = lines[j], lines[i] })
+	train := lines[:min(*trainSize, len(lines))]
+	test := lines[len(train):min(len(train)+*testSize, len(lines))]
+	fmt.Printf("训练集 %d 题，验证集 %d 题\n", len(train), len(test))
+
+	printScore := func(title string, p HeuristicParams, score TuneScore) {
+		fmt.Printf("%s  分支 %d  演算 %d  耗时 %.3fs  %s\n",
+			title, score.Branches, score.EvalCount, score.Duration.Seconds(), p)
+	}
+	defaults := DefaultHeuristicParams()
+	defaults.StopAtFirstSolution = *one
+	printScore("默认参数", defaults, EvaluateHeuristic(train, defaults))
+	best, _ := TuneHeuristic(&TuneConfig{
+		Train:               train,
+		Iterations:          *iterations,
+		Objective:           *objective,
+		StopAtFirstSolution: *one,
+		Rand:                rnd,
+		OnImprove: func(iteration int, p HeuristicParams, score TuneScore) {
+			printScore(fmt.Sprintf("第 %d 轮", iteration), p, score)
+		},
+	})
+
+	if len(test) == 0 {
+		return
+	}
+	fmt.Println("验证集：")
+	printScore("默认参数", defaults, EvaluateHeuristic(test, defaults))
+	printScore("最佳参数", best, EvaluateHeuristic(test, best))
+}
+
+const MsgUsageVariant = `使用方法：
+
+gosudoku variant <file> 求解变体数独谜题
+gosudoku variant        从标准输入获取谜题
+
+谜题文件是9行的盘面加上指令行，例如：
+
+    variant x windoku
+    .....1...
+    ...
+
+可用的变体：%v
+
+不规则区域数独（jigsaw）用 regions 指令加上9行区域图代替宫，相同的字符代表同一个区域：
+
+    regions
+    AAABBCCCC
+    ...
+
+overlay 指令加上9行覆盖层声明单元格的属性：e 是偶数格，o 是奇数格，f 是堡垒格（大于上下左右相邻的非堡垒格），
+. 是普通单元格。
+
+杀手数独用 cage 指令加入笼子：笼内数字不重复，和为指定的值，例如 cage 15 r1c1 r1c2 r2c1。
+-generate killer 随机生成一个有唯一解的杀手数独，输出谜题文件。
+
+相邻单元格之间的标记，每两个单元格一对：
+    kropki white r1c1 r1c2    白点，两数相差 1
+    kropki black r1c1 r2c1    黑点，一个数是另一个的两倍
+    xv x r1c1 r1c2            两数的和为 10（v 为 5）
+    gt r1c1 r1c2              前一个单元格的数大于后一个
+    negative kropki xv        否定约束：没有标记的相邻单元格不满足这一组标记的关系
+
+线约束按顺序列出线经过的单元格，相邻的单元格可以斜向相邻：
+    thermo r1c1 r1c2 r2c3     温度计，从泡（第一个单元格）开始严格递增
+    arrow r1c1 r2c2 r3c3      箭头，圆圈（第一个单元格）等于箭头上其他单元格的和
+    palindrome r1c1 r2c1 ...  回文线，正着读和倒着读相同
+    whisper r1c1 r1c2 ...     德国耳语线，相邻的单元格相差至少 5
+    renban r1c1 r1c2 ...      连续线，数字互不相同且是一组连续的数字
+
+盘面外的线索写在盘面外的位置，r0、r10 是上方、下方，c0、c10 是左侧、右侧：
+    sandwich r0c5 12          三明治，第5列中 1 和 9 之间的数字之和
+    skyscraper r3c10 4        摩天楼，从第3行右侧看到 4 栋楼（比前面的楼都高）
+    little-killer r0c1 se 30  小杀手，从 r0c1 向右下（ne、nw、se、sw）的斜线之和，数字可以重复
+
+合体数独用 gattai 指令声明，写在其他指令之前，盘面是整个拼图的行，不在盘面上的位置写空格：
+    gattai samurai            武士数独，21*21，另有 twodoku、butterfly、flower、sohei
+    gattai r1c1 r7c7          自定义，列出每个 9*9 盘面左上角的单元格，必须按宫对齐
+合体数独不支持 variant、regions、overlay 和盘面外的线索。
+
+title、author、source、rating 指令写出谜题的标题、作者、出处和难度，不影响求解。
+
+以 { 开头的文件是 JSON 格式，包含上面所有的内容，-schema 输出它的 JSON Schema；
+-export text 或 -export json 把谜题转换为另一种格式输出，不求解。
+
+-one、-process、-stat 选项同样有效，需要写在 variant 之前。包含标准行、列、宫的 9*9 谜题在默认算法上求解，
+还可以使用 -iterative、-parallel、-strategy、-gens-apply-rules 等选项；
+-engine sat 只支持只有额外的房的变体（x、windoku 等）。不规则区域和合体数独使用单独的求解器，不支持这些选项。
+
+`
+
+// exportVariant 按 format 输出谜题，format 为空时输出文本格式
+func exportVariant(vp *VariantPuzzle, format string) {
+	if format != "json" {
+		fmt.Print(vp.String())
+		return
+	}
+	data, err := vp.JSON()
+	check(err)
+	fmt.Println(string(data))
+}
+
+// runVariant 执行 variant 命令：用 VariantSolver 求解带指令的变体谜题文件
+func runVariant(args []string) {
+	fs := flag.NewFlagSet("variant", flag.ExitOnError)
+	generate := fs.String("generate", "", "生成谜题而不是求解：killer")
+	seed := fs.Int64("seed", 0, "生成谜题的随机种子，0 表示使用当前时间")
+	export := fs.String("export", "", "输出谜题而不是求解：text 或 json，可用于两种格式的转换")
+	schema := fs.Bool("schema", false, "输出 JSON 格式的 JSON Schema")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, MsgUsageVariant, VariantNames())
+		fs.PrintDefaults()
+	}
+	check(fs.Parse(args))
+	if *export != "" && *export != "text" && *export != "json" {
+		check(fmt.Errorf("unknown export format %q", *export))
+	}
+	if *schema {
+		fmt.Print(PuzzleSchema)
+		return
+	}
+
+	if *generate != "" {
+		if *generate != "killer" {
+			check(fmt.Errorf("unknown puzzle type %q", *generate))
+		}
+		if *seed == 0 {
+			*seed = time.Now().UnixNano()
+		}
+		vp := GenerateKiller(rand.New(rand.NewSource(*seed)))
+		exportVariant(vp, *export)
+		if *flagShowProcess {
+			ShowGrid(vp.NewGrid(), "生成的谜题", -1)
+		}
+		return
+	}
+
+	raw, err := io.ReadAll(openInput(fs.Arg(0)))
+	check(err)
+	//以 { 开头的是 JSON 格式
+	var vp *VariantPuzzle
+	if bytes.HasPrefix(bytes.TrimSpace(raw), []byte("{")) {
+		vp, err = ParseVariantJSON(raw)
+	} else {
+		vp, err = ParseVariantPuzzle(string(raw))
+	}
+	check(err)
+	if *export != "" {
+		exportVariant(vp, *export)
+		return
+	}
+
+	show := func(cells *[9][9]int8, title string) {
+		ShowGrid(vp.gridFromCells(cells), title, -1)
+	}
+	rules, rulesErr := NewVariantRules(vp)
+	switch *flagEngine {
+	case "default":
+		if rulesErr == nil {
+			solveVariantSituation(vp, show)
+		} else {
+			solveVariantGrid(vp)
+		}
+	case "sat":
+		check(rulesErr)
+		clauses, err := rules.Clauses()
+		check(err)
+		x := NewSATSolver()
+		x.ExtraClauses = clauses
+		var givens [9][9]int8
+		for i, n := range vp.Givens {
+			givens[i/9][i%9] = n
+		}
+		solveWithEngine(x, &givens, show)
+		if *flagShowStat {
+			fmt.Printf("变体：%v\n", vp.Variants)
+		}
+	default:
+		check(fmt.Errorf("engine %q is not supported by variant puzzles, available: [default sat]", *flagEngine))
+	}
+}
+
+// solveVariantSituation 在启用了变体规则的 Situation 上用 SudokuContext 求解，支持求解命令的所有搜索选项
+func solveVariantSituation(vp *VariantPuzzle, show func(cells *[9][9]int8, title string)) {
+	s, t, err := vp.NewSituation()
+	check(err)
+	ctx := newContextFromFlags()
+	startTime := time.Now()
+	count := ctx.Run(s, t)
+	dur := time.Since(startTime)
+	if count > 0 {
+		fmt.Printf("\n找到了 %d 个解\n", count)
+		for i, answer := range ctx.solutions {
+			show(answer, fmt.Sprintf("解 %d", i+1))
+		}
+	} else {
+		ShowGrid(vp.NewGrid(), "失败", -1)
+	}
+	if *flagShowStat {
+		fmt.Printf("变体：%v\n", vp.Variants)
+		showContextStat(ctx, dur)
+	}
+}
+
+// gridUnsupportedFlags 是 VariantSolver 不支持的求解选项
+var gridUnsupportedFlags = []string{
+	"iterative", "parallel", "strategy", "gens-apply-rules", "adaptive-rules", "branch",
+}
+
+// solveVariantGrid 用 VariantSolver 求解不规则区域和合体数独，Situation 的搜索选项不可用
+func solveVariantGrid(vp *VariantPuzzle) {
+	flag.Visit(func(f *flag.Flag) {
+		if slices.Contains(gridUnsupportedFlags, f.Name) {
+			check(fmt.Errorf("-%s is not supported by jigsaw and gattai puzzles", f.Name))
+		}
+	})
+	vs := NewVariantSolver(vp)
+	vs.ShowProcess = *flagShowProcess
+	var solutions []*Grid
+	startTime := time.Now()
+	count := vs.Run(func(g *Grid) bool {
+		solutions = append(solutions, g.Clone())
+		return !*flagStopAtFirstSolution
+	})
+	dur := time.Since(startTime)
+	if count > 0 {
+		fmt.Printf("\n找到了 %d 个解\n", count)
+		for i, g := range solutions {
+			ShowGrid(g, fmt.Sprintf("解 %d", i+1), -1)
+		}
+	} else {
+		ShowGrid(vp.NewGrid(), "失败", -1)
+	}
+	if *flagShowStat {
+		stats := vs.Stats()
+		fmt.Printf("变体：%v\n", vp.Variants)
+		fmt.Printf("总耗时：%v\n", dur)
+		fmt.Printf("二叉分支数：%d\n", stats.BranchCount[2])
+		fmt.Printf("多叉支数：%d\n", stats.SumBranches()-stats.BranchCount[2])
+		fmt.Printf("总演算次数 %d\n", stats.EvalCount)
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+// DLXSolver 使用 Knuth 的 Dancing Links（Algorithm X）把数独作为精确覆盖问题求解。
+//
+// 精确覆盖矩阵有 729 行，每行代表一个填数 (r,c,n)；324 列，每列代表一个必须恰好满足一次的条件：
+//
+//	0   ~ 80  : 单元格 (r,c) 填了数
+//	81  ~ 161 : 行 r 填了 n
+//	162 ~ 242 : 列 c 填了 n
+//	243 ~ 323 : 宫 b 填了 n
+//
+// 矩阵只在创建时构造一次，每次求解后把覆盖操作全部撤销，所以同一个 DLXSolver 可以反复使用，但不能并发使用。
+type DLXSolver struct {
+	//节点的四向链表，下标 0 是根节点，1~324 是列头，其后是数据节点
+	left, right, up, down []int32
+	//节点所在的列头
+	column []int32
+	//数据节点所在的矩阵行，即填数 (r*9+c)*9+n
+	row []int16
+	//列头所在列的剩余节点数
+	size []int32
+	//rowNode[x] 是矩阵第 x 行的第一个节点
+	rowNode [729]int32
+
+	solution [9][9]int8
+	yield    func(solution *[9][9]int8) bool
+	stopped  bool
+	count    int
+	stats    SolverStats
+}
+
+const (
+	dlxColumns = 4 * 81
+	dlxRows    = 729
+)
+
+func NewDLXSolver() *DLXSolver {
+	nodes := 1 + dlxColumns + dlxRows*4
+	x := &DLXSolver{
+		left:   make([]int32, nodes),
+		right:  make([]int32, nodes),
+		up:     make([]int32, nodes),
+		down:   make([]int32, nodes),
+		column: make([]int32, nodes),
+		row:    make([]int16, nodes),
+		size:   make([]int32, 1+dlxColumns),
+	}
+	for i := int32(0); i <= dlxColumns; i++ {
+		x.left[i] = (i + dlxColumns) % (dlxColumns + 1)
+		x.right[i] = (i + 1) % (dlxColumns + 1)
+		x.up[i] = i
+		x.down[i] = i
+		x.column[i] = i
+	}
+
+	next := int32(1 + dlxColumns)
+	for r := range loop9 {
+		for c := range loop9 {
+			b, _ := rcbp(int8(r), int8(c))
+			for n := range loop9 {
+				cols := [4]int32{
+					1 + int32(r*9+c),
+					1 + 81 + int32(r*9+n),
+					1 + 162 + int32(c*9+n),
+					1 + 243 + int32(int(b)*9+n),
+				}
+				rowID := int16((r*9+c)*9 + n)
+				first := next
+				x.rowNode[rowID] = first
+				for i, col := range cols {
+					node := next
+					next++
+					x.column[node] = col
+					x.row[node] = rowID
+					//插入到列的末尾
+					x.up[node] = x.up[col]
+					x.down[node] = col
+					x.down[x.up[col]] = node
+					x.up[col] = node
+					x.size[col]++
+					//行内循环链表
+					x.left[node] = first + int32((i+3)%4)
+					x.right[node] = first + int32((i+1)%4)
+				}
+			}
+		}
+	}
+	return x
+}
+
+func (x *DLXSolver) cover(col int32) {
+	x.right[x.left[col]] = x.right[col]
+	x.left[x.right[col]] = x.left[col]
+	for i := x.down[col]; i != col; i = x.down[i] {
+		for j := x.right[i]; j != i; j = x.right[j] {
+			x.down[x.up[j]] = x.down[j]
+			x.up[x.down[j]] = x.up[j]
+			x.size[x.column[j]]--
+		}
+	}
+}
+
+func (x *DLXSolver) uncover(col int32) {
+	for i := x.up[col]; i != col; i = x.up[i] {
+		for j := x.left[i]; j != i; j = x.left[j] {
+			x.size[x.column[j]]++
+			x.down[x.up[j]] = j
+			x.up[x.down[j]] = j
+		}
+	}
+	x.right[x.left[col]] = col
+	x.left[x.right[col]] = col
+}
+
+// selectRow 选中数据节点 node 所在的矩阵行，覆盖该行涉及的所有列
+func (x *DLXSolver) selectRow(node int32) {
+	for j := node; ; {
+		x.cover(x.column[j])
+		j = x.right[j]
+		if j == node {
+			break
+		}
+	}
+}
+
+// unselectRow 撤销 selectRow，顺序与覆盖相反
+func (x *DLXSolver) unselectRow(node int32) {
+	for j := x.left[node]; ; {
+		x.uncover(x.column[j])
+		if j == node {
+			break
+		}
+		j = x.left[j]
+	}
+}
+
+// isCovered 返回列 col 是否已经被覆盖（从列头链表中移除）
+func (x *DLXSolver) isCovered(col int32) bool {
+	return x.right[x.left[col]] != col
+}
+
+func (x *DLXSolver) Solve(puzzle *[9][9]int8, yield func(solution *[9][9]int8) bool) int {
+	x.yield = yield
+	x.stopped = false
+	x.count = 0
+	x.stats = SolverStats{}
+	x.solution = *puzzle
+
+	//先选中所有线索对应的行，如果线索之间冲突则无解
+	var selected []int32
+	conflict := false
+	for r := range loop9 {
+		for c := range loop9 {
+			n := puzzle[r][c]
+			if n < 0 {
+				continue
+			}
+			node := x.rowNode[(r*9+c)*9+int(n)]
+			for j := node; ; {
+				if x.isCovered(x.column[j]) {
+					conflict = true
+				}
+				j = x.right[j]
+				if j == node {
+					break
+				}
+			}
+			if conflict {
+				break
+			}
+			x.selectRow(node)
+			selected = append(selected, node)
+		}
+		if conflict {
+			break
+		}
+	}
+
+	if !conflict {
+		x.search()
+	}
+
+	for i := len(selected) - 1; i >= 0; i-- {
+		x.unselectRow(selected[i])
+	}
+	x.yield = nil
+	return x.count
+}
+
+func (x *DLXSolver) search() {
+	if x.right[0] == 0 {
+		x.count++
+		if x.yield != nil && !x.yield(&x.solution) {
+			x.stopped = true
+		}
+		return
+	}
+
+	//选择剩余节点最少的列
+	col := x.right[0]
+	for j := x.right[col]; j != 0; j = x.right[j] {
+		if x.size[j] < x.size[col] {
+			col = j
+		}
+	}
+	size := x.size[col]
+	if size == 0 {
+		return
+	}
+	if size > 1 {
+		x.stats.BranchCount[min(size, 9)]++
+	}
+
+	x.cover(col)
+	for i := x.down[col]; i != col && !x.stopped; i = x.down[i] {
+		x.stats.EvalCount++
+		rowID := x.row[i]
+		cell := rowID / 9
+		x.solution[cell/9][cell%9] = int8(rowID % 9)
+		for j := x.right[i]; j != i; j = x.right[j] {
+			x.cover(x.column[j])
+		}
+		x.search()
+		for j := x.left[i]; j != i; j = x.left[j] {
+			x.uncover(x.column[j])
+		}
+		x.solution[cell/9][cell%9] = -1
+	}
+	x.uncover(col)
+}
+
+func (x *DLXSolver) Stats() SolverStats {
+	return x.stats
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+// solveAll 用 solver 求 puzzle 的所有解
+func solveAll(solver Solver, puzzle *[9][9]int8) map[[9][9]int8]bool {
+	solutions := make(map[[9][9]int8]bool)
+	solver.Solve(puzzle, func(solution *[9][9]int8) bool {
+		solutions[*solution] = true
+		return true
+	})
+	return solutions
+}
+
+// crossCheckSolvers 检查两个算法对 puzzle 给出完全相同的解集
+func crossCheckSolvers(t *testing.T, a, b Solver, puzzle *[9][9]int8) {
+	t.Helper()
+	solutionsA := solveAll(a, puzzle)
+	solutionsB := solveAll(b, puzzle)
+	if len(solutionsA) != len(solutionsB) {
+		t.Fatalf("解的数量不一致 %d != %d：%s", len(solutionsA), len(solutionsB), FormatCellsLine(puzzle))
+	}
+	for solution := range solutionsA {
+		if !solutionsB[solution] || !isSolutionOf(puzzle, &solution) {
+			t.Fatalf("解不一致：%s", FormatCellsLine(puzzle))
+		}
+	}
+}
+
+func TestDLXCrossCheck(t *testing.T) {
+	dlx := NewDLXSolver()
+	oracle := &PropagationSolver{}
+	for _, file := range []string{"assets/17_clue.txt", "assets/hardest_1106.txt", "assets/hardest_1905_11.txt"} {
+		lines := readPuzzleLines(openInput(file))
+		for _, line := range lines[:100] {
+			puzzle, err := ParseCellsFromLine(line)
+			check(err)
+			crossCheckSolvers(t, dlx, oracle, puzzle)
+		}
+	}
+
+	raw, err := os.ReadFile("puzzles/hard-02.txt")
+	check(err)
+	multi, _ := ParseSituation(".........\n" + string(raw[10:]))
+	crossCheckSolvers(t, dlx, oracle, &multi.cells)
+
+	conflict, _ := ParseSituation("11.......")
+	crossCheckSolvers(t, dlx, oracle, &conflict.cells)
+}
+
+func TestDLXStop(t *testing.T) {
+	s, _ := ParseSituation(multiSolutionPuzzle)
+	calls := 0
+	count := NewDLXSolver().Solve(&s.cells, func(solution *[9][9]int8) bool {
+		calls++
+		return calls < 3
+	})
+	if count != 3 || calls != 3 {
+		t.Fatalf("yield 返回 false 后应该停止，找到 %d 个解", count)
+	}
+}
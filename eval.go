@@ -2,6 +2,8 @@ package main
 
 import (
 	"fmt"
+	"iter"
+	"math/rand"
 	"strings"
 )
 
@@ -11,17 +13,68 @@ type SudokuContext struct {
 	StopAtFirstSolution bool
 	GensApplyRules      int
 
+	//在所有分支中按收益动态启用或关闭每类复杂排除规则，代替 GensApplyRules 的固定代数，统计见 RuleStats
+	AdaptiveRules bool
+	//AdaptiveRules 启用一类规则所需的最近每微秒新增排除数，0 表示使用默认值，负数表示总是启用
+	MinRuleYield float64
+
+	//OnSolution 不为 nil 时，每找到一个解调用一次，解不再保存到 solutions。
+	//solution 指向的数组在回调返回后会被复用，需要保留时应复制一份。
+	//返回 false 表示停止搜索。
+	OnSolution func(solution *[9][9]int8) bool
+
+	//Rand 不为 nil 时，每个分支的候选项按随机顺序尝试，用于随机抽取解
+	Rand *rand.Rand
+
+	//使用显式栈的迭代搜索，分支时不复制局势，而是用 Trail 撤销修改
+	Iterative bool
+
+	//分支策略，nil 时使用 DefaultStrategy
+	Strategy BranchStrategy
+
+	//不为 nil 时，复用之前的搜索中演算过的局势的结果，见 TranspositionCache
+	Cache *TranspositionCache
+
+	//大于1时，用多个线程搜索同一个谜题的分支，线程之间互相窃取未演算的分支
+	Parallel int
+
+	stopped bool
+	//recurseEval 在还有未尝试的分支时停止（找到第一个解、OnSolution 要求停止），或者使用了不完整的缓存结果。
+	//此时正在搜索的局势都只有部分的解，不能作为完整的结果保存到缓存
+	truncated     bool
 	evalCount     int
 	rulesDebranch int
 	branchCount   [10]int
 	solutions     []*[9][9]int8
+	//使用 Cache 时，recurseEval 记录找到的解，用于保存到缓存
+	found     [][9][9]int8
+	ruleStats [len(ruleFamilies)]RuleStats
 }
 
 func NewSudokuContext() *SudokuContext {
 	return &SudokuContext{}
 }
 
+// Validate 检查选项的组合是否支持：多线程搜索不能使用 Cache，也不能显示中间步骤和分支结构；
+// 迭代搜索不能使用 Cache
+func (ctx *SudokuContext) Validate() error {
+	if ctx.Parallel > 1 && (ctx.Cache != nil || ctx.ShowProcess || ctx.ShowBranch) {
+		return fmt.Errorf("parallel search does not support cache, process or branch output")
+	}
+	if ctx.Iterative && ctx.Cache != nil {
+		return fmt.Errorf("iterative search does not support cache")
+	}
+	return nil
+}
+
+// Run 搜索局势 s 的所有解（或按选项找到第一个解即停止），返回解的数量。选项不支持时 panic，见 Validate。
 func (ctx *SudokuContext) Run(s *Situation, t *Trigger) int {
+	if err := ctx.Validate(); err != nil {
+		panic(err)
+	}
+	ctx.stopped = false
+	ctx.truncated = false
+	ctx.found = ctx.found[:0]
 	if ctx.ShowProcess {
 		s.Show("开始", -1, -1)
 	}
@@ -34,7 +87,49 @@ func (ctx *SudokuContext) Run(s *Situation, t *Trigger) int {
 		}
 		return 0
 	}
-	return ctx.recurseEval(s, t, fmt.Sprintf("<%d>", s.Count()))
+	if ctx.Parallel > 1 {
+		return ctx.parallelEval(s, t)
+	}
+	if ctx.Iterative {
+		return ctx.iterativeEval(s, t)
+	}
+	name := ""
+	if ctx.ShowBranch {
+		name = fmt.Sprintf("<%d>", s.Count())
+	}
+	return ctx.recurseEval(s, t, name)
+}
+
+// reset 清除统计和结果，保留已分配的内存，用于复用同一个 SudokuContext
+func (ctx *SudokuContext) reset() {
+	ctx.evalCount = 0
+	ctx.rulesDebranch = 0
+	ctx.branchCount = [10]int{}
+	ctx.ruleStats = [len(ruleFamilies)]RuleStats{}
+	ctx.solutions = ctx.solutions[:0]
+}
+
+// Solutions 返回一个迭代器，在搜索过程中逐个产生局势 s 的解，而不是全部保存在内存中。
+// 产生的解在下一次迭代时会被覆盖，需要保留时应复制一份。
+func (ctx *SudokuContext) Solutions(s *Situation, t *Trigger) iter.Seq[*[9][9]int8] {
+	return func(yield func(*[9][9]int8) bool) {
+		ctx.OnSolution = yield
+		defer func() { ctx.OnSolution = nil }()
+		ctx.Run(s, t)
+	}
+}
+
+// SampleSolution 以随机的分支顺序搜索，返回找到的第一个解。
+// 这不是严格的均匀抽样，但多次调用可以得到分布较散的不同解。
+func SampleSolution(s *Situation, t *Trigger, rnd *rand.Rand) (*[9][9]int8, bool) {
+	ctx := &SudokuContext{
+		StopAtFirstSolution: true,
+		Rand:                rnd,
+	}
+	if ctx.Run(s, t) == 0 {
+		return nil, false
+	}
+	return ctx.solutions[0], true
 }
 
 // recurseEval 开始推断局势 s，并返回所有可能的终局。
@@ -43,13 +138,7 @@ func (ctx *SudokuContext) recurseEval(s *Situation, t *Trigger, branchName strin
 	if ctx.ShowBranch {
 		fmt.Println(branchName, "开始")
 	}
-	var result bool
-	if s.branchGeneration < ctx.GensApplyRules {
-		result = ctx.logicalEvalWithRules(s, t)
-	} else {
-		result = ctx.logicalEval(s, t)
-	}
-	if !result {
+	if !ctx.branchEval(s, t) {
 		if ctx.ShowBranch {
 			fmt.Println(branchName, fmt.Sprintf("演算到 <%d> 矛盾", s.Count()))
 		}
@@ -59,22 +148,34 @@ func (ctx *SudokuContext) recurseEval(s *Situation, t *Trigger, branchName strin
 		if ctx.ShowBranch {
 			fmt.Println(branchName, "找到解")
 		}
-		cells := s.cells
-		ctx.solutions = append(ctx.solutions, &cells)
+		if ctx.Cache != nil {
+			ctx.found = append(ctx.found, s.cells)
+		}
+		ctx.addSolution(s)
 		return 1
 	}
 
+	if ctx.Cache != nil {
+		if count, ok := ctx.lookupCache(s); ok {
+			if ctx.ShowBranch {
+				fmt.Println(branchName, fmt.Sprintf("缓存命中，%d 个解", count))
+			}
+			return count
+		}
+	}
+	foundStart := len(ctx.found)
+
 	//当前没有找到确定的填充选项，所以获取所有可能选项，然后在所有可能的选项里选一个单元格做尝试。
 
 	//选取一个单元格和Num进行尝试
-	candidates := s.ChooseBranchCell1()
-	// guess := s.ChooseGuessingCell2()
+	candidates := ctx.chooseBranch(s)
 	ctx.branchCount[candidates.Size()]++
 	if candidates.Size() == 0 {
 		return 0
 	}
+	ctx.shuffle(candidates)
 	var count int
-	for _, selected := range candidates.Choices {
+	for i, selected := range candidates.Choices {
 		s2 := DuplicateSituation(s)
 		t2 := DuplicateTrigger(t)
 		s2.branchGeneration++
@@ -99,11 +200,17 @@ func (ctx *SudokuContext) recurseEval(s *Situation, t *Trigger, branchName strin
 		}
 		ReleaseSituation(s2)
 		ReleaseTrigger(t2)
-		if len(t.Conflicts) > 0 || count > 0 && ctx.StopAtFirstSolution {
+		if len(t.Conflicts) > 0 || count > 0 && ctx.StopAtFirstSolution || ctx.stopped {
+			if i < len(candidates.Choices)-1 || ctx.stopped {
+				ctx.truncated = true
+			}
 			break
 		}
 	}
 	ReleaseBranchChoices(candidates)
+	if ctx.Cache != nil {
+		ctx.storeCache(s, !ctx.truncated, count, foundStart)
+	}
 
 	if ctx.ShowBranch {
 		txt := "无解"
@@ -115,13 +222,135 @@ func (ctx *SudokuContext) recurseEval(s *Situation, t *Trigger, branchName strin
 	return count
 }
 
+// branchEval 按分支代数或 AdaptiveRules 决定是否使用复杂排除规则，推断局势 s。
+// 如果返回false，表示这个局势有矛盾。
+func (ctx *SudokuContext) branchEval(s *Situation, t *Trigger) bool {
+	if ctx.AdaptiveRules || s.branchGeneration < ctx.GensApplyRules {
+		return ctx.logicalEvalWithRules(s, t)
+	}
+	return ctx.logicalEval(s, t)
+}
+
+// addSolution 记录已完成的局势 s，或交给 OnSolution
+func (ctx *SudokuContext) addSolution(s *Situation) {
+	ctx.addSolutionCells(&s.cells)
+}
+
+func (ctx *SudokuContext) addSolutionCells(cells *[9][9]int8) {
+	if ctx.OnSolution != nil {
+		if !ctx.OnSolution(cells) {
+			ctx.stopped = true
+		}
+	} else {
+		solution := *cells
+		ctx.solutions = append(ctx.solutions, &solution)
+	}
+}
+
+// chooseBranch 按 ctx.Strategy 选择分支的候选项
+func (ctx *SudokuContext) chooseBranch(s *Situation) *BranchChoices {
+	if ctx.Strategy == nil {
+		return s.ChooseBranchCell1()
+	}
+	return ctx.Strategy.ChooseBranch(s)
+}
+
+func (ctx *SudokuContext) shuffle(candidates *BranchChoices) {
+	if ctx.Rand != nil {
+		ctx.Rand.Shuffle(len(candidates.Choices), func(i, j int) {
+			candidates.Choices[i], candidates.Choices[j] = candidates.Choices[j], candidates.Choices[i]
+		})
+	}
+}
+
+// iterativeEval 与 recurseEval 结果相同，但使用显式栈代替递归，
+// 并且始终在同一个局势上演算：尝试下一个候选项前，用 Trail 撤销上一个候选项产生的所有修改。
+func (ctx *SudokuContext) iterativeEval(s *Situation, t *Trigger) int {
+	type frame struct {
+		candidates *BranchChoices
+		next       int
+		mark       TrailMark
+		generation int
+	}
+	trail := &Trail{}
+	t.trail = trail
+	defer func() { t.trail = nil }()
+	var stack []frame
+	count := 0
+
+	for {
+		//演算当前局势，如果需要分支则压栈
+		if ctx.branchEval(s, t) {
+			if s.Completed() {
+				ctx.addSolution(s)
+				count++
+			} else {
+				candidates := ctx.chooseBranch(s)
+				ctx.branchCount[candidates.Size()]++
+				if candidates.Size() > 0 {
+					ctx.shuffle(candidates)
+					stack = append(stack, frame{
+						candidates: candidates,
+						mark:       trail.Mark(s),
+						generation: s.branchGeneration,
+					})
+				}
+			}
+		} else if ctx.ShowBranch {
+			fmt.Println(fmt.Sprintf("<%d>", s.Count()), "矛盾")
+		}
+
+		//找到下一个没有矛盾的候选项
+		for len(stack) > 0 {
+			top := &stack[len(stack)-1]
+			if top.next == top.candidates.Size() || count > 0 && ctx.StopAtFirstSolution || ctx.stopped {
+				ReleaseBranchChoices(top.candidates)
+				stack = stack[:len(stack)-1]
+				continue
+			}
+			trail.Undo(s, top.mark)
+			t.Init()
+			s.branchGeneration = top.generation + 1
+			selected := top.candidates.Choices[top.next]
+			top.next++
+			s.Set(t, selected)
+			ctx.evalCount++
+			if ctx.ShowProcess {
+				s.Show("在可能的选项里猜一个", int(selected.Row), int(selected.Col))
+			}
+			if len(t.Conflicts) == 0 {
+				break
+			}
+		}
+		if len(stack) == 0 {
+			return count
+		}
+	}
+}
+
 // logicalEval 开始推断局势 s，直到没有找到确定的填充选项，不确保全部完成。
 // 如果返回false，表示这个局势有矛盾。
 func (ctx *SudokuContext) logicalEval(s *Situation, t *Trigger) bool {
 	for {
 		rcn, ok := t.GetConfirm()
 		if !ok {
-			break
+			//没有待填的数时应用变体约束，约束得到新的待填的数时继续
+			if s.variant == nil || !s.applyConstraints(t) {
+				break
+			}
+			if len(t.Conflicts) > 0 {
+				if ctx.ShowProcess {
+					fmt.Println("变体约束发生矛盾：")
+					for _, msg := range t.Conflicts {
+						fmt.Println(msg)
+					}
+				}
+				return false
+			}
+			if t.confirms.Size() == 0 {
+				break
+			}
+			continue
 		}
 		cellNumExcludes := countTrueBits(s.numExcludeMask[rcn.Row][rcn.Col])
 		rowExcludes := countTrueBits(s.rowExcludeMask[rcn.Num][rcn.Row])
@@ -165,6 +394,10 @@ func (ctx *SudokuContext) logicalEval(s *Situation, t *Trigger) bool {
 
 // 如果返回false，表示这个局势有矛盾。
 func (ctx *SudokuContext) logicalEvalWithRules(s *Situation, t *Trigger) bool {
+	//变体约束在没有待填的数时也需要应用，可能得到新的待填的数
+	if s.variant != nil && t.confirms.Size() == 0 && !ctx.logicalEval(s, t) {
+		return false
+	}
 	for t.confirms.Size() > 0 {
 		if !ctx.logicalEval(s, t) {
 			return false
@@ -172,7 +405,7 @@ func (ctx *SudokuContext) logicalEvalWithRules(s *Situation, t *Trigger) bool {
 		if s.Completed() {
 			return true
 		}
-		changed := s.ApplyExcludeRules(t)
+		changed := ctx.applyRules(s, t)
 		if ctx.ShowProcess || ctx.ShowBranch {
 			fmt.Printf("应用复杂排除规则，新增排除 %d 单元格\n", changed)
 		}
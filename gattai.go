@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// gattaiLayouts 是常见的合体数独（gattai），值是每个 9*9 盘面左上角的位置。
+// 盘面重叠的单元格是同一个单元格，同时受所有包含它的盘面的行、列、宫约束。
+var gattaiLayouts = map[string][]RowCol{
+	//武士数独：中央的盘面与四角的盘面各共用一个宫，21*21
+	"samurai": {{0, 0}, {0, 12}, {6, 6}, {12, 0}, {12, 12}},
+	//双胞胎：两个盘面共用一个宫，15*15
+	"twodoku": {{0, 0}, {6, 6}},
+	//蝴蝶：四个盘面两两重叠，12*12
+	"butterfly": {{0, 0}, {0, 3}, {3, 0}, {3, 3}},
+	//花朵：中央的盘面与上下左右的盘面各共用六个宫，15*15
+	"flower": {{0, 3}, {3, 0}, {3, 3}, {3, 6}, {6, 3}},
+	//僧兵：四个盘面围成一圈，相邻的盘面共用一个宫，21*21
+	"sohei": {{0, 6}, {6, 0}, {6, 12}, {12, 6}},
+}
+
+// GattaiNames 返回所有合体数独的名称
+func GattaiNames() []string {
+	var names []string
+	for name := range gattaiLayouts {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// NewGattaiLayout 创建多个 9*9 盘面拼成的盘面，corners 是每个盘面左上角的位置。
+// 不在任何一个盘面上的单元格没有房，Layout.Present 返回 false。
+func NewGattaiLayout(corners []RowCol) *Layout {
+	rows, cols := 0, 0
+	for _, corner := range corners {
+		rows = max(rows, int(corner.Row)+9)
+		cols = max(cols, int(corner.Col)+9)
+	}
+	l := NewLayout(rows, cols, GattaiHouses(corners, cols))
+	l.absent = make([]bool, l.Size())
+	for i := range l.absent {
+		if len(l.cellHouses[i]) == 0 {
+			l.absent[i] = true
+			l.absentCount++
+		}
+	}
+	l.blockOutline()
+	return l
+}
+
+// GattaiHouses 返回每个盘面的 9 行、9 列、9 宫，cols 是整个盘面的列数。
+// 盘面共用的宫（以及花朵数独中完全重合的行、列）只保留一次。
+func GattaiHouses(corners []RowCol, cols int) []House {
+	var houses []House
+	seen := make(map[[9]int]bool)
+	add := func(house House) {
+		if !seen[house.Cells] {
+			seen[house.Cells] = true
+			houses = append(houses, house)
+		}
+	}
+	for k, corner := range corners {
+		r0, c0 := int(corner.Row), int(corner.Col)
+		for i := range 9 {
+			row := House{Name: fmt.Sprintf("盘面%d第%d行", k+1, i+1)}
+			col := House{Name: fmt.Sprintf("盘面%d第%d列", k+1, i+1)}
+			for j := range 9 {
+				row.Cells[j] = (r0+i)*cols + c0 + j
+				col.Cells[j] = (r0+j)*cols + c0 + i
+			}
+			add(row)
+			add(col)
+		}
+		for b := range 9 {
+			block := House{Name: fmt.Sprintf("盘面%d第%d宫", k+1, b+1)}
+			for p := range 9 {
+				block.Cells[p] = (r0+b/3*3+p/3)*cols + c0 + b%3*3 + p%3
+			}
+			add(block)
+		}
+	}
+	return houses
+}
+
+// parseGattai 解析 gattai 指令的参数：合体数独的名称，或者每个盘面左上角的单元格，例如 r1c1 r7c7。
+// 盘面必须按 3*3 的宫对齐，并且不能完全重合。
+func parseGattai(args []string) ([]RowCol, error) {
+	if len(args) == 1 {
+		if corners, ok := gattaiLayouts[args[0]]; ok {
+			return corners, nil
+		}
+	}
+	if len(args) < 2 {
+		return nil, fmt.Errorf("expect a name in %v or at least 2 corners", GattaiNames())
+	}
+	var corners []RowCol
+	for _, token := range args {
+		var r, c int
+		var rest string
+		if n, _ := fmt.Sscanf(strings.ToLower(token), "r%dc%d%s", &r, &c, &rest); n != 2 || r < 1 || c < 1 || r > 100 || c > 100 {
+			return nil, fmt.Errorf("invalid corner %q", token)
+		}
+		if (r-1)%3 != 0 || (c-1)%3 != 0 {
+			return nil, fmt.Errorf("corner %s is not aligned to 3*3 boxes", token)
+		}
+		corner := RowCol{int8(r - 1), int8(c - 1)}
+		if slices.Contains(corners, corner) {
+			return nil, fmt.Errorf("duplicate corner %s", token)
+		}
+		corners = append(corners, corner)
+	}
+	return corners, nil
+}
+
+// gattaiDirective 返回 gattai 指令，常见的合体数独写名称
+func gattaiDirective(corners []RowCol) string {
+	for _, name := range GattaiNames() {
+		if slices.Equal(gattaiLayouts[name], corners) {
+			return "gattai " + name
+		}
+	}
+	var tokens []string
+	for _, corner := range corners {
+		tokens = append(tokens, fmt.Sprintf("r%dc%d", corner.Row+1, corner.Col+1))
+	}
+	return "gattai " + strings.Join(tokens, " ")
+}
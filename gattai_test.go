@@ -0,0 +1,107 @@
+package main
+
+import (
+	"math/rand"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// checkGattaiSolution 按每个盘面的行、列、宫检查合体数独的解，不依赖 Layout 的房
+func checkGattaiSolution(t *testing.T, name string, corners []RowCol, g *Grid) {
+	l := g.Layout()
+	for k, corner := range corners {
+		var cells [9][9]int8
+		for r := range 9 {
+			for c := range 9 {
+				cells[r][c] = g.Get(l.Index(int(corner.Row)+r, int(corner.Col)+c))
+			}
+		}
+		if !isSolutionOf(&EmptySituation.cells, &cells) {
+			t.Fatalf("%s：盘面%d 不是有效的终局", name, k+1)
+		}
+	}
+}
+
+func TestGattaiLayouts(t *testing.T) {
+	cells := map[string]int{"samurai": 369, "twodoku": 153, "butterfly": 144, "flower": 189, "sohei": 288}
+	for _, name := range GattaiNames() {
+		corners := gattaiLayouts[name]
+		vp := &VariantPuzzle{Gattai: corners}
+		l := vp.Layout()
+		if got := l.Size() - l.absentCount; got != cells[name] {
+			t.Fatalf("%s 应该有 %d 个单元格，实际 %d 个", name, cells[name], got)
+		}
+		for i := range l.Size() {
+			if l.Present(i) != (len(l.cellHouses[i]) > 0) {
+				t.Fatalf("%s：%s 是否在盘面上与房不一致", name, l.CellName(i))
+			}
+		}
+		vs := &VariantSolver{Puzzle: vp, Rand: rand.New(rand.NewSource(1))}
+		count := vs.Run(func(g *Grid) bool {
+			checkGattaiSolution(t, name, corners, g)
+			return false
+		})
+		if count != 1 {
+			t.Fatalf("%s：空盘面没有解", name)
+		}
+	}
+}
+
+func TestGattaiPuzzleFile(t *testing.T) {
+	filename := "puzzles/samurai-01.txt"
+	raw, err := os.ReadFile(filename)
+	check(err)
+	vp, err := ParseVariantPuzzle(string(raw))
+	check(err)
+	if !slices.Equal(vp.Gattai, gattaiLayouts["samurai"]) {
+		t.Fatalf("%s 不是武士数独", filename)
+	}
+	count := NewVariantSolver(vp).Run(func(g *Grid) bool {
+		checkGattaiSolution(t, filename, vp.Gattai, g)
+		return true
+	})
+	if count != 1 {
+		t.Fatalf("%s 应该有唯一解，找到 %d 个", filename, count)
+	}
+
+	parsed, err := ParseVariantPuzzle(vp.String())
+	check(err)
+	if !slices.Equal(parsed.Gattai, vp.Gattai) || !slices.Equal(parsed.Givens, vp.Givens) {
+		t.Fatalf("%s：导出后重新解析不一致", filename)
+	}
+	if vp.String() != string(raw) {
+		t.Fatalf("%s：导出的文本与文件不同", filename)
+	}
+}
+
+func TestParseGattai(t *testing.T) {
+	//一行写出整个盘面的 15*15 个字符
+	custom, err := ParseVariantPuzzle("gattai r1c1 r7c7\ncage 10 r15c15 r15c14\n" + strings.Repeat(".", 224) + "5\n")
+	check(err)
+	if l := custom.Layout(); l.Rows != 15 || l.Cols != 15 || custom.Givens[l.Index(14, 14)] != 4 {
+		t.Fatalf("自定义的合体数独解析错误")
+	}
+	if got := gattaiDirective(custom.Gattai); got != "gattai twodoku" {
+		t.Fatalf("与双胞胎相同的合体数独应该导出为名称，实际是 %q", got)
+	}
+	raw, err := os.ReadFile("puzzles/samurai-01.txt")
+	check(err)
+	for _, bad := range []string{
+		"gattai unknown\n",
+		"gattai r1c1\n",
+		"gattai r1c1 r2c7\n",
+		"gattai r1c1 r1c1\n",
+		"cage 10 r1c1 r1c2\ngattai samurai\n",
+		string(raw) + "variant x\n",
+		"gattai samurai\ncage 10 r10c1 r10c2\n",
+		//第10行的第1列不在盘面上
+		"gattai twodoku\n" + strings.Repeat(".", 135) + "5" + strings.Repeat(".", 89) + "\n",
+		"gattai twodoku\n" + multiSolutionPuzzle,
+	} {
+		if _, err := ParseVariantPuzzle(bad); err == nil {
+			t.Fatalf("应该返回错误：%q", bad)
+		}
+	}
+}
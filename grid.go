@@ -0,0 +1,481 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// Grid 是 Layout 上的一个局势，用于变体数独。
+// 候选数以位表示，每个单元格一个掩码，分支时整体复制。
+type Grid struct {
+	layout *Layout
+	//cells[i] = n ：单元格 i 填了 n（0~8），-1 为未填
+	cells []int8
+	//candidates[i] 的每一位代表单元格 i 还可以填哪些数字，已填的单元格只保留所填的数
+	candidates []int16
+	//已填单元格数
+	setCount int
+	//矛盾的原因，空字符串代表没有矛盾
+	conflict string
+}
+
+func NewGrid(l *Layout) *Grid {
+	g := &Grid{
+		layout:     l,
+		cells:      make([]int8, l.Size()),
+		candidates: make([]int16, l.Size()),
+	}
+	for i := range g.cells {
+		g.cells[i] = -1
+		if l.Present(i) {
+			g.candidates[i] = 511
+		}
+	}
+	return g
+}
+
+func (g *Grid) Clone() *Grid {
+	g2 := *g
+	g2.cells = append([]int8(nil), g.cells...)
+	g2.candidates = append([]int16(nil), g.candidates...)
+	return &g2
+}
+
+func (g *Grid) Layout() *Layout {
+	return g.layout
+}
+
+// Get 返回单元格 i 填的数，-1 为未填
+func (g *Grid) Get(i int) int8 {
+	return g.cells[i]
+}
+
+// Candidates 返回单元格 i 的候选数掩码
+func (g *Grid) Candidates(i int) int16 {
+	return g.candidates[i]
+}
+
+func (g *Grid) Count() int {
+	return g.setCount
+}
+
+func (g *Grid) Completed() bool {
+	return g.setCount+g.layout.absentCount == len(g.cells)
+}
+
+// Conflict 返回矛盾的原因，没有矛盾时返回空字符串
+func (g *Grid) Conflict() string {
+	return g.conflict
+}
+
+func (g *Grid) fail(format string, args ...any) {
+	if g.conflict == "" {
+		g.conflict = fmt.Sprintf(format, args...)
+	}
+}
+
+// Set 在单元格 i 填 n，并从同房的其他单元格排除 n。单元格已填时返回 false。
+func (g *Grid) Set(i int, n int8) bool {
+	if g.cells[i] != -1 {
+		if g.cells[i] != n {
+			g.fail("单元格 %s 已经填了 %d，不能再填 %d", g.layout.CellName(i), g.cells[i]+1, n+1)
+		}
+		return false
+	}
+	if g.candidates[i]&(1<<n) == 0 {
+		g.fail("单元格 %s 不能填 %d", g.layout.CellName(i), n+1)
+	}
+	g.cells[i] = n
+	g.candidates[i] = 1 << n
+	g.setCount++
+	for _, j := range g.layout.peers[i] {
+		g.Exclude(j, n)
+	}
+	return true
+}
+
+// Exclude 从单元格 i 排除 n，返回是否有变化。排除后没有候选数时记录矛盾。
+func (g *Grid) Exclude(i int, n int8) bool {
+	if g.candidates[i]&(1<<n) == 0 {
+		return false
+	}
+	g.candidates[i] &^= 1 << n
+	if g.candidates[i] == 0 {
+		g.fail("单元格 %s 没有可以填的数字", g.layout.CellName(i))
+	}
+	return true
+}
+
+// CellName 返回单元格 i 的名称，例如 (1,2)
+func (l *Layout) CellName(i int) string {
+	r, c := l.RowCol(i)
+	return fmt.Sprintf("(%d,%d)", r+1, c+1)
+}
+
+// ToCells 把 9*9 盘面的局势复制到 cells
+func (g *Grid) ToCells(cells *[9][9]int8) {
+	for i, n := range g.cells {
+		cells[i/9][i%9] = n
+	}
+}
+
+// ShowGrid 与 ShowCells 格式相同，显示任意大小的盘面，每3行、3列加分隔线。
+// 不规则区域数独画出区域的边框，杀手数独画出笼子的边框和笼子的和，相邻单元格之间的标记画在边框上，
+// 合体数独的空白处不画边框。
+func ShowGrid(g *Grid, title string, i int) {
+	l := g.layout
+	if l.outline != nil {
+		showBordered(g, title, i)
+		return
+	}
+	width := l.Cols*3 + (l.Cols-1)/3
+	fmt.Println(strings.Repeat("=", width))
+	fmt.Println(title)
+	for r := range l.Rows {
+		for c := range l.Cols {
+			j := l.Index(r, c)
+			s := " "
+			if n := g.cells[j]; n >= 0 {
+				s = strconv.Itoa(int(n + 1))
+			}
+			if j == i {
+				fmt.Printf("[%s]", s)
+			} else {
+				fmt.Printf(" %s ", s)
+			}
+			if c%3 == 2 && c != l.Cols-1 {
+				fmt.Printf("|")
+			}
+		}
+		fmt.Println()
+		if r%3 == 2 && r != l.Rows-1 {
+			fmt.Println(strings.Repeat("-", width))
+		}
+	}
+}
+
+// showBordered 显示盘面，相邻单元格的 Layout.outline 不同时在它们之间画边框，
+// Layout.outlineLabels 显示在单元格的上边框
+func showBordered(g *Grid, title string, i int) {
+	l := g.layout
+	//盘面外，以及合体数独中不在盘面上的位置，视为同一个区域
+	region := func(r, c int) int {
+		if r < 0 || c < 0 || r >= l.Rows || c >= l.Cols || !l.Present(l.Index(r, c)) {
+			return math.MinInt
+		}
+		return l.outline[l.Index(r, c)]
+	}
+	//differ 返回两个位置之间是否需要边框，盘面以外的位置视为同一个区域
+	differ := func(r1, c1, r2, c2 int) bool {
+		return region(r1, c1) != region(r2, c2)
+	}
+	//border 返回第 r 行上方的边框线
+	border := func(r int) string {
+		var sb strings.Builder
+		for c := -1; c < l.Cols; c++ {
+			if c >= 0 {
+				if label, ok := l.outlineLabels[l.Index(r, c)]; ok && r < l.Rows {
+					sb.WriteString(label + strings.Repeat("-", max(3-len(label), 0)))
+				} else if mark, ok := l.marks[[2]int{l.Index(r-1, c), l.Index(r, c)}]; ok && r > 0 && r < l.Rows {
+					if differ(r-1, c, r, c) {
+						sb.WriteString("-" + mark + "-")
+					} else {
+						sb.WriteString(" " + mark + " ")
+					}
+				} else if differ(r-1, c, r, c) {
+					sb.WriteString("---")
+				} else {
+					sb.WriteString("   ")
+				}
+			}
+			if differ(r-1, c, r-1, c+1) || differ(r, c, r, c+1) || differ(r-1, c, r, c) || differ(r-1, c+1, r, c+1) {
+				sb.WriteString("+")
+			} else {
+				sb.WriteString(" ")
+			}
+		}
+		return sb.String()
+	}
+	//盘面外的线索显示在四周的空白里，每个位置占 4 个字符
+	margin := ""
+	if len(l.outsideLabels) > 0 {
+		margin = "    "
+	}
+	outside := func(r, c int) string {
+		return l.outsideLabels[[2]int{r, c}]
+	}
+	//labelRow 返回盘面上方（r=-1）或下方（r=Rows）的线索
+	labelRow := func(r int) string {
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "%3s  ", outside(r, -1))
+		for c := range l.Cols {
+			label := outside(r, c)
+			if len(label) == 1 {
+				label = " " + label
+			}
+			fmt.Fprintf(&sb, "%-4s", label)
+		}
+		sb.WriteString(outside(r, l.Cols))
+		return strings.TrimRight(sb.String(), " ")
+	}
+	fmt.Println(strings.Repeat("=", l.Cols*4+1+len(margin)*2))
+	fmt.Println(title)
+	if margin != "" {
+		fmt.Println(labelRow(-1))
+	}
+	for r := range l.Rows {
+		fmt.Println(margin + border(r))
+		if margin != "" {
+			fmt.Printf("%3s ", outside(r, -1))
+		}
+		if differ(r, -1, r, 0) {
+			fmt.Print("|")
+		} else {
+			fmt.Print(" ")
+		}
+		for c := range l.Cols {
+			j := l.Index(r, c)
+			s := " "
+			if n := g.cells[j]; n >= 0 {
+				s = strconv.Itoa(int(n + 1))
+			}
+			if j == i {
+				fmt.Printf("[%s]", s)
+			} else {
+				fmt.Printf(" %s ", s)
+			}
+			if mark, ok := l.marks[[2]int{j, j + 1}]; ok && c+1 < l.Cols {
+				fmt.Print(mark)
+			} else if differ(r, c, r, c+1) {
+				fmt.Print("|")
+			} else {
+				fmt.Print(" ")
+			}
+		}
+		if label := outside(r, l.Cols); label != "" {
+			fmt.Print(" " + label)
+		}
+		fmt.Println()
+	}
+	fmt.Println(margin + border(l.Rows))
+	if margin != "" {
+		fmt.Println(labelRow(l.Rows))
+	}
+}
+
+// VariantSolver 求解 Situation 不能表示的盘面：不规则区域数独和合体数独，它们的宫不是固定的 3*3，或者不止 9*9。
+// 推理使用唯一数、唯一位置，以及任意两个相交的房之间的区块排除，推理停止后在候选数最少的单元格分支。
+// 包含标准行、列、宫的 9*9 变体谜题在 Situation 上求解（VariantPuzzle.Run），VariantSolver 不接受它们，见 Validate。
+type VariantSolver struct {
+	Puzzle      *VariantPuzzle
+	ShowProcess bool
+	//Rand 不为 nil 时，分支的候选数按随机顺序尝试，用于生成谜题
+	Rand *rand.Rand
+
+	stopped bool
+	stats   SolverStats
+}
+
+func NewVariantSolver(vp *VariantPuzzle) *VariantSolver {
+	return &VariantSolver{Puzzle: vp}
+}
+
+// Validate 检查谜题是否需要 VariantSolver：Situation 可以表示的盘面返回错误
+func (vs *VariantSolver) Validate() error {
+	if _, err := NewVariantRules(vs.Puzzle); err == nil {
+		return fmt.Errorf("variant solver: standard 9x9 layouts are solved on Situation, use VariantPuzzle.Run")
+	}
+	return nil
+}
+
+// Run 求解谜题，每找到一个解调用一次 yield，yield 返回 false 表示停止搜索。返回找到的解的数量。
+// 谜题不需要 VariantSolver 时 panic，见 Validate。
+func (vs *VariantSolver) Run(yield func(g *Grid) bool) int {
+	if err := vs.Validate(); err != nil {
+		panic(err)
+	}
+	vs.stopped = false
+	vs.stats = SolverStats{}
+	g := vs.Puzzle.NewGrid()
+	if vs.ShowProcess {
+		ShowGrid(g, "开始", -1)
+	}
+	return vs.eval(g, yield)
+}
+
+// Solve 使 VariantSolver 实现 Solver：用 puzzle 代替谜题的已知数，只支持 9*9 的不规则区域数独
+func (vs *VariantSolver) Solve(puzzle *[9][9]int8, yield func(solution *[9][9]int8) bool) int {
+	vp := *vs.Puzzle
+	vp.Givens = make([]int8, 81)
+	for i := range vp.Givens {
+		vp.Givens[i] = puzzle[i/9][i%9]
+	}
+	puzzleSolver := &VariantSolver{Puzzle: &vp, ShowProcess: vs.ShowProcess, Rand: vs.Rand}
+	var solution [9][9]int8
+	count := puzzleSolver.Run(func(g *Grid) bool {
+		g.ToCells(&solution)
+		return yield(&solution)
+	})
+	vs.stats = puzzleSolver.stats
+	return count
+}
+
+func (vs *VariantSolver) Stats() SolverStats {
+	return vs.stats
+}
+
+func (vs *VariantSolver) eval(g *Grid, yield func(g *Grid) bool) int {
+	if !vs.propagate(g) {
+		if vs.ShowProcess {
+			fmt.Println("发生矛盾：")
+			fmt.Println(g.conflict)
+		}
+		return 0
+	}
+	if g.Completed() {
+		if vs.ShowProcess {
+			fmt.Println("找到了一个解")
+		}
+		if !yield(g) {
+			vs.stopped = true
+		}
+		return 1
+	}
+
+	//选择候选数最少的单元格，合体数独在所有盘面中选择
+	best, bestCount := -1, int8(10)
+	for i, n := range g.cells {
+		if n == -1 && g.layout.Present(i) && countTrueBits(g.candidates[i]) < bestCount {
+			best, bestCount = i, countTrueBits(g.candidates[i])
+		}
+	}
+	vs.stats.BranchCount[bestCount]++
+	var tmpArray [9]int8
+	nums := tmpArray[:0]
+	for n := range int8(9) {
+		if g.candidates[best]&(1<<n) != 0 {
+			nums = append(nums, n)
+		}
+	}
+	if vs.Rand != nil {
+		vs.Rand.Shuffle(len(nums), func(i, j int) { nums[i], nums[j] = nums[j], nums[i] })
+	}
+	count := 0
+	for _, n := range nums {
+		g2 := g.Clone()
+		g2.Set(best, n)
+		vs.stats.EvalCount++
+		if vs.ShowProcess {
+			ShowGrid(g2, fmt.Sprintf("<%02d> 在可能的选项里猜一个", g2.setCount), best)
+		}
+		count += vs.eval(g2, yield)
+		if vs.stopped {
+			break
+		}
+	}
+	return count
+}
+
+// propagate 反复应用推理规则，直到没有新的结论。返回 false 表示局势矛盾。
+func (vs *VariantSolver) propagate(g *Grid) bool {
+	for g.conflict == "" {
+		if !vs.applySingles(g) && !vs.applyLockedCandidates(g) && !vs.applyConstraints(g) {
+			break
+		}
+	}
+	return g.conflict == ""
+}
+
+// applyConstraints 应用谜题的所有 Constraint，返回是否有新的排除
+func (vs *VariantSolver) applyConstraints(g *Grid) bool {
+	changed := false
+	for _, constraint := range vs.Puzzle.Constraints() {
+		if constraint.Propagate(g) {
+			changed = true
+		}
+		if g.conflict != "" {
+			return true
+		}
+	}
+	return changed
+}
+
+// applySingles 填入唯一数（单元格只剩一个候选数）和唯一位置（房内只有一个单元格可以填某个数），返回是否填了数
+func (vs *VariantSolver) applySingles(g *Grid) bool {
+	changed := false
+	for i, n := range g.cells {
+		if n == -1 && countTrueBits(g.candidates[i]) == 1 {
+			vs.set(g, i, pos0(^g.candidates[i]&511), -1)
+			changed = true
+		}
+		if g.conflict != "" {
+			return true
+		}
+	}
+	for h, house := range g.layout.Houses {
+		for n := range int8(9) {
+			place, places := -1, 0
+			for _, i := range house.Cells {
+				if g.candidates[i]&(1<<n) != 0 {
+					place = i
+					places++
+				}
+			}
+			if places == 0 {
+				g.fail("%s 没有单元格可以填 %d", house.Name, n+1)
+				return true
+			}
+			if places == 1 && g.cells[place] == -1 {
+				vs.set(g, place, n, h)
+				changed = true
+				if g.conflict != "" {
+					return true
+				}
+			}
+		}
+	}
+	return changed
+}
+
+// applyLockedCandidates 应用区块排除：如果房 a 中可以填 n 的单元格都在与房 b 的交集里，
+// b 的其他单元格排除 n。返回是否有新的排除。
+func (vs *VariantSolver) applyLockedCandidates(g *Grid) bool {
+	changed := false
+	for _, overlap := range g.layout.overlaps {
+		cellsA := &g.layout.Houses[overlap.a].Cells
+		for n := range int8(9) {
+			locked := true
+			for k, i := range cellsA {
+				if g.candidates[i]&(1<<n) != 0 && !overlap.inA[k] {
+					locked = false
+					break
+				}
+			}
+			if !locked {
+				continue
+			}
+			for _, j := range overlap.outB {
+				if g.Exclude(j, n) {
+					changed = true
+				}
+			}
+		}
+	}
+	return changed
+}
+
+// set 填入推理得到的数，house 是唯一位置所在的房，-1 代表唯一数
+func (vs *VariantSolver) set(g *Grid, i int, n int8, house int) {
+	g.Set(i, n)
+	vs.stats.EvalCount++
+	if vs.ShowProcess {
+		reason := "单元格唯一可以填的数"
+		if house >= 0 {
+			reason = fmt.Sprintf("%s唯一可以填 %d 的位置", g.layout.Houses[house].Name, n+1)
+		}
+		ShowGrid(g, fmt.Sprintf("<%02d> %s", g.setCount, reason), i)
+	}
+}
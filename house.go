@@ -0,0 +1,346 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// House 是九个单元格组成的"房"，1~9 在其中各出现一次。
+// 标准数独的房是 9 行、9 列、9 宫，变体数独可以有额外的房。
+type House struct {
+	Name string
+	//单元格编号，见 Layout.Index
+	Cells [9]int
+}
+
+// Layout 是盘面的形状和所有的房。与 Situation 把行、列、宫写死在 Set 里不同，Layout 的房可以是任意九个单元格，
+// 所以可以加入对角线、窗口等额外的房。包含标准行、列、宫的 9*9 盘面由 VariantRules 把额外的房加到 Situation 上，
+// 其他盘面（不规则区域、合体数独）由 VariantSolver 在 Grid 上求解。
+type Layout struct {
+	Rows, Cols int
+	Houses     []House
+
+	//cellHouses[i] 是单元格 i 所在的房在 Houses 中的下标
+	cellHouses [][]int
+	//peers[i] 是与单元格 i 同房的其他单元格，填数时从这些单元格排除同一个数
+	peers [][]int
+	//overlaps 是所有交集至少两个单元格的房对，用于区块排除
+	overlaps []houseOverlap
+	//不为 nil 时，显示时按 outline 画出边框，而不是 3*3 宫的分隔线：
+	//outline[i] 是单元格 i 所在的区域（不规则区域或杀手数独的笼子），不同区域的相邻单元格之间有边框
+	outline []int
+	//outlineLabels[i] 显示在单元格 i 的上边框，例如笼子的和
+	outlineLabels map[int]string
+	//marks[{a,b}] 显示在相邻单元格 a<b 之间的边框上，例如 Kropki 的点
+	marks map[[2]int]string
+	//outsideLabels[{r,c}] 显示在盘面外的位置 (r,c)，r、c 可以是 -1 或 Rows、Cols，例如三明治线索
+	outsideLabels map[[2]int]string
+	//不为 nil 时，absent[i] 为 true 代表单元格 i 不在任何一个盘面上（合体数独的空白处），不需要填数
+	absent      []bool
+	absentCount int
+}
+
+// houseOverlap 是两个相交的房 a、b：如果 a 中可以填 n 的单元格都在交集里，b 的其他单元格排除 n
+type houseOverlap struct {
+	a, b int
+	//inA[i] 为 true 代表 House a 的第 i 个单元格在交集里
+	inA [9]bool
+	//b 中不在交集里的单元格
+	outB []int
+}
+
+// NewLayout 创建 rows*cols 的盘面，houses 是所有的房
+func NewLayout(rows, cols int, houses []House) *Layout {
+	l := &Layout{
+		Rows:       rows,
+		Cols:       cols,
+		Houses:     houses,
+		cellHouses: make([][]int, rows*cols),
+		peers:      make([][]int, rows*cols),
+	}
+	for h, house := range houses {
+		for _, i := range house.Cells {
+			l.cellHouses[i] = append(l.cellHouses[i], h)
+		}
+	}
+	for i := range l.peers {
+		seen := map[int]bool{i: true}
+		for _, h := range l.cellHouses[i] {
+			for _, j := range houses[h].Cells {
+				if !seen[j] {
+					seen[j] = true
+					l.peers[i] = append(l.peers[i], j)
+				}
+			}
+		}
+		sort.Ints(l.peers[i])
+	}
+	for a := range houses {
+		for b := range houses {
+			if a == b {
+				continue
+			}
+			overlap := houseOverlap{a: a, b: b}
+			size := 0
+			for k, i := range houses[a].Cells {
+				if houses[b].contains(i) {
+					overlap.inA[k] = true
+					size++
+				}
+			}
+			if size < 2 {
+				continue
+			}
+			for _, j := range houses[b].Cells {
+				if !houses[a].contains(j) {
+					overlap.outB = append(overlap.outB, j)
+				}
+			}
+			if len(overlap.outB) > 0 {
+				l.overlaps = append(l.overlaps, overlap)
+			}
+		}
+	}
+	return l
+}
+
+// blockOutline 在没有 outline 时按 3*3 的宫画边框，用于需要在边框上显示标记的谜题
+func (l *Layout) blockOutline() {
+	if l.outline != nil {
+		return
+	}
+	l.outline = make([]int, l.Size())
+	for i := range l.outline {
+		r, c := l.RowCol(i)
+		l.outline[i] = r/3*l.Cols + c/3
+	}
+}
+
+// addPeers 使 cells 中的单元格互为同伴：填数时从其他单元格排除同一个数，但它们不必包含全部九个数字
+func (l *Layout) addPeers(cells []int) {
+	for _, i := range cells {
+		for _, j := range cells {
+			if i != j && !slices.Contains(l.peers[i], j) {
+				l.peers[i] = append(l.peers[i], j)
+			}
+		}
+		sort.Ints(l.peers[i])
+	}
+}
+
+func (h *House) contains(i int) bool {
+	for _, j := range h.Cells {
+		if j == i {
+			return true
+		}
+	}
+	return false
+}
+
+// Index 返回单元格 (r,c) 的编号
+func (l *Layout) Index(r, c int) int {
+	return r*l.Cols + c
+}
+
+// RowCol 返回编号为 i 的单元格的行、列
+func (l *Layout) RowCol(i int) (int, int) {
+	return i / l.Cols, i % l.Cols
+}
+
+// Present 返回单元格 i 是否在盘面上
+func (l *Layout) Present(i int) bool {
+	return l.absent == nil || !l.absent[i]
+}
+
+// Size 返回盘面的单元格数量
+func (l *Layout) Size() int {
+	return l.Rows * l.Cols
+}
+
+// StandardHouses 返回标准数独的 9 行、9 列、9 宫
+func StandardHouses() []House {
+	return append(LineHouses(), BlockHouses()...)
+}
+
+// LineHouses 返回 9 行、9 列
+func LineHouses() []House {
+	var houses []House
+	for i := range 9 {
+		row := House{Name: fmt.Sprintf("第%d行", i+1)}
+		col := House{Name: fmt.Sprintf("第%d列", i+1)}
+		for j := range 9 {
+			row.Cells[j] = i*9 + j
+			col.Cells[j] = j*9 + i
+		}
+		houses = append(houses, row, col)
+	}
+	return houses
+}
+
+// BlockHouses 返回 9 个 3*3 的宫
+func BlockHouses() []House {
+	var houses []House
+	for b := range 9 {
+		block := House{Name: fmt.Sprintf("第%d宫", b+1)}
+		for p := range 9 {
+			block.Cells[p] = (b/3*3+p/3)*9 + b%3*3 + p%3
+		}
+		houses = append(houses, block)
+	}
+	return houses
+}
+
+// RegionHouses 返回不规则区域数独（jigsaw）代替宫的区域，regions[i] 是单元格 i 所在区域的编号 0~8
+func RegionHouses(regions []int8) []House {
+	houses := make([]House, 9)
+	sizes := make([]int, 9)
+	for i, x := range regions {
+		houses[x].Cells[sizes[x]] = i
+		sizes[x]++
+	}
+	for x := range houses {
+		houses[x].Name = fmt.Sprintf("区域%c", 'A'+x)
+	}
+	return houses
+}
+
+// ParseRegions 解析 9 行 9 个字符的区域图，相同的字符代表同一个区域，区域按第一次出现的顺序编号。
+// 必须恰好有 9 个区域，每个区域 9 个单元格，并且上下左右连通。
+func ParseRegions(rows []string) ([]int8, error) {
+	if len(rows) != 9 {
+		return nil, fmt.Errorf("regions: expect 9 rows, got %d", len(rows))
+	}
+	regions := make([]int8, 81)
+	labels := map[rune]int8{}
+	sizes := map[int8]int{}
+	for r, row := range rows {
+		if len([]rune(row)) != 9 {
+			return nil, fmt.Errorf("regions: row %d should have 9 characters", r+1)
+		}
+		for c, label := range []rune(row) {
+			x, ok := labels[label]
+			if !ok {
+				if len(labels) == 9 {
+					return nil, fmt.Errorf("regions: more than 9 regions")
+				}
+				x = int8(len(labels))
+				labels[label] = x
+			}
+			regions[r*9+c] = x
+			sizes[x]++
+		}
+	}
+	for label, x := range labels {
+		if sizes[x] != 9 {
+			return nil, fmt.Errorf("regions: region %c has %d cells", label, sizes[x])
+		}
+		if !regionConnected(regions, x) {
+			return nil, fmt.Errorf("regions: region %c is not connected", label)
+		}
+	}
+	if len(labels) != 9 {
+		return nil, fmt.Errorf("regions: expect 9 regions, got %d", len(labels))
+	}
+	return regions, nil
+}
+
+// regionConnected 检查区域 x 的单元格是否上下左右连通
+func regionConnected(regions []int8, x int8) bool {
+	start, size := -1, 0
+	for i, x0 := range regions {
+		if x0 == x {
+			size++
+			if start < 0 {
+				start = i
+			}
+		}
+	}
+	seen := map[int]bool{start: true}
+	stack := []int{start}
+	for len(stack) > 0 {
+		i := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		r, c := i/9, i%9
+		for _, j := range [4]int{i - 9, i + 9, i - 1, i + 1} {
+			if j < 0 || j >= 81 || j/9 != r && j%9 != c || seen[j] || regions[j] != x {
+				continue
+			}
+			seen[j] = true
+			stack = append(stack, j)
+		}
+	}
+	return len(seen) == size
+}
+
+// houseVariants 是可以用 variant 指令加入的额外的房，见 VariantNames
+var houseVariants = map[string]func() []House{
+	"x":          DiagonalHouses,
+	"windoku":    WindokuHouses,
+	"disjoint":   DisjointGroupHouses,
+	"asterisk":   AsteriskHouses,
+	"centre-dot": CentreDotHouses,
+}
+
+// DiagonalHouses 返回对角线数独（Sudoku-X）的两条对角线
+func DiagonalHouses() []House {
+	main, anti := House{Name: "主对角线"}, House{Name: "副对角线"}
+	for i := range 9 {
+		main.Cells[i] = i*9 + i
+		anti.Cells[i] = i*9 + 8 - i
+	}
+	return []House{main, anti}
+}
+
+// WindokuHouses 返回窗口数独（Windoku、Hyper）的四个窗口：第2~4、6~8行与第2~4、6~8列相交的 3*3 区域
+func WindokuHouses() []House {
+	var houses []House
+	for w := range 4 {
+		house := House{Name: fmt.Sprintf("窗口%d", w+1)}
+		r0, c0 := 1+w/2*4, 1+w%2*4
+		for j := range 9 {
+			house.Cells[j] = (r0+j/3)*9 + c0 + j%3
+		}
+		houses = append(houses, house)
+	}
+	return houses
+}
+
+// DisjointGroupHouses 返回不连续组数独（Disjoint Groups）的九个组：每宫同一位置的单元格
+func DisjointGroupHouses() []House {
+	var houses []House
+	for p := range 9 {
+		house := House{Name: fmt.Sprintf("位置组%d", p+1)}
+		for b := range 9 {
+			house.Cells[b] = (b/3*3+p/3)*9 + b%3*3 + p%3
+		}
+		houses = append(houses, house)
+	}
+	return houses
+}
+
+// AsteriskHouses 返回星号数独（Asterisk）的星号区域
+func AsteriskHouses() []House {
+	return []House{{Name: "星号", Cells: [9]int{
+		1*9 + 4, 2*9 + 2, 2*9 + 6, 4*9 + 1, 4*9 + 4, 4*9 + 7, 6*9 + 2, 6*9 + 6, 7*9 + 4,
+	}}}
+}
+
+// CentreDotHouses 返回中心点数独（Centre-dot）的九个宫中心
+func CentreDotHouses() []House {
+	house := House{Name: "宫中心"}
+	for b := range 9 {
+		house.Cells[b] = (b/3*3+1)*9 + b%3*3 + 1
+	}
+	return []House{house}
+}
+
+// VariantNames 返回 variant 指令可用的所有变体名称，包括 MoveRuleNames
+func VariantNames() []string {
+	names := MoveRuleNames()
+	for name := range houseVariants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PuzzleSchema 是 JSON 格式的变体谜题的 JSON Schema
+//
+//go:embed schema/puzzle.schema.json
+var PuzzleSchema string
+
+// jsonPuzzle 是变体谜题的 JSON 格式，见 schema/puzzle.schema.json。
+// 单元格写成 "r1c2"；盘面、区域图和覆盖层是字符串数组，每行一个字符串，与文本格式相同。
+type jsonPuzzle struct {
+	Title  string `json:"title,omitempty"`
+	Author string `json:"author,omitempty"`
+	Source string `json:"source,omitempty"`
+	Rating string `json:"rating,omitempty"`
+	//盘面的行数、列数，省略时由 gattai 决定，默认 9*9
+	Rows int `json:"rows,omitempty"`
+	Cols int `json:"cols,omitempty"`
+	//合体数独的名称，或者每个盘面左上角的单元格
+	Gattai   []string      `json:"gattai,omitempty"`
+	Variants []string      `json:"variants,omitempty"`
+	Givens   []string      `json:"givens"`
+	Regions  []string      `json:"regions,omitempty"`
+	Overlay  []string      `json:"overlay,omitempty"`
+	Cages    []jsonCage    `json:"cages,omitempty"`
+	Dots     []jsonDot     `json:"dots,omitempty"`
+	Negative []string      `json:"negative,omitempty"`
+	Lines    []jsonLine    `json:"lines,omitempty"`
+	Outside  []jsonOutside `json:"outside,omitempty"`
+}
+
+type jsonCage struct {
+	Sum   int      `json:"sum"`
+	Cells []string `json:"cells"`
+}
+
+// jsonDot 是相邻单元格之间的标记，Kind 见 relationKinds
+type jsonDot struct {
+	Kind  string   `json:"kind"`
+	Cells []string `json:"cells"`
+}
+
+// jsonLine 是线约束，Kind 见 lineKinds
+type jsonLine struct {
+	Kind  string   `json:"kind"`
+	Cells []string `json:"cells"`
+}
+
+// jsonOutside 是盘面外的线索，Kind 见 outsideKinds，Direction 只有小杀手需要
+type jsonOutside struct {
+	Kind      string `json:"kind"`
+	Position  string `json:"position"`
+	Direction string `json:"direction,omitempty"`
+	Value     int    `json:"value"`
+}
+
+// ParseVariantJSON 解析 JSON 格式的变体谜题。
+// 每一项都转换为文本格式的指令，由 variantDirectives 解析，所以检查与 ParseVariantPuzzle 相同。
+func ParseVariantJSON(data []byte) (*VariantPuzzle, error) {
+	var doc jsonPuzzle
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("json: %w", err)
+	}
+	p := &variantParser{
+		vp:    &VariantPuzzle{Info: PuzzleInfo{Title: doc.Title, Author: doc.Author, Source: doc.Source, Rating: doc.Rating}},
+		shape: NewLayout(9, 9, nil),
+	}
+	//run 执行一条指令，rows 是指令之后的行（区域图、覆盖层）
+	run := func(field string, fields []string, rows []string) error {
+		p.lines, p.pos = rows, 0
+		if err := variantDirectives[fields[0]](p, fields[1:]); err != nil {
+			return fmt.Errorf("%s: %w", field, err)
+		}
+		return nil
+	}
+	if doc.Gattai != nil {
+		if err := run("gattai", append([]string{"gattai"}, doc.Gattai...), nil); err != nil {
+			return nil, err
+		}
+	}
+	if doc.Rows != 0 && doc.Rows != p.shape.Rows || doc.Cols != 0 && doc.Cols != p.shape.Cols {
+		return nil, fmt.Errorf("size %d*%d does not match the grid %d*%d", doc.Rows, doc.Cols, p.shape.Rows, p.shape.Cols)
+	}
+	if doc.Variants != nil {
+		if err := run("variants", append([]string{"variant"}, doc.Variants...), nil); err != nil {
+			return nil, err
+		}
+	}
+	if doc.Regions != nil {
+		if err := run("regions", []string{"regions"}, doc.Regions); err != nil {
+			return nil, err
+		}
+	}
+	if doc.Overlay != nil {
+		if err := run("overlay", []string{"overlay"}, doc.Overlay); err != nil {
+			return nil, err
+		}
+	}
+	for k, cage := range doc.Cages {
+		if err := run(fmt.Sprintf("cages[%d]", k), append([]string{"cage", strconv.Itoa(cage.Sum)}, cage.Cells...), nil); err != nil {
+			return nil, err
+		}
+	}
+	for k, dot := range doc.Dots {
+		kind, ok := relationKinds[dot.Kind]
+		if !ok {
+			return nil, fmt.Errorf("dots[%d]: unknown kind %q", k, dot.Kind)
+		}
+		if err := run(fmt.Sprintf("dots[%d]", k), append(strings.Fields(kind.directive), dot.Cells...), nil); err != nil {
+			return nil, err
+		}
+	}
+	if doc.Negative != nil {
+		if err := run("negative", append([]string{"negative"}, doc.Negative...), nil); err != nil {
+			return nil, err
+		}
+	}
+	for k, line := range doc.Lines {
+		if _, ok := lineKinds[line.Kind]; !ok {
+			return nil, fmt.Errorf("lines[%d]: unknown kind %q", k, line.Kind)
+		}
+		if err := run(fmt.Sprintf("lines[%d]", k), append([]string{line.Kind}, line.Cells...), nil); err != nil {
+			return nil, err
+		}
+	}
+	for k, clue := range doc.Outside {
+		if _, ok := outsideKinds[clue.Kind]; !ok {
+			return nil, fmt.Errorf("outside[%d]: unknown kind %q", k, clue.Kind)
+		}
+		fields := []string{clue.Kind, clue.Position}
+		if clue.Direction != "" {
+			fields = append(fields, clue.Direction)
+		}
+		fields = append(fields, strconv.Itoa(clue.Value))
+		if err := run(fmt.Sprintf("outside[%d]", k), fields, nil); err != nil {
+			return nil, err
+		}
+	}
+	vp, err := p.finish(doc.Givens)
+	if err != nil {
+		return nil, fmt.Errorf("givens: %w", err)
+	}
+	return vp, nil
+}
+
+// JSON 返回 JSON 格式的谜题，ParseVariantJSON 可以解析
+func (vp *VariantPuzzle) JSON() ([]byte, error) {
+	l := vp.Layout()
+	cells := func(cells []int) []string {
+		return strings.Fields(formatCells(l, cells))
+	}
+	doc := jsonPuzzle{
+		Title:    vp.Info.Title,
+		Author:   vp.Info.Author,
+		Source:   vp.Info.Source,
+		Rating:   vp.Info.Rating,
+		Rows:     l.Rows,
+		Cols:     l.Cols,
+		Variants: vp.Variants,
+		Givens:   vp.givenRows(),
+		Negative: vp.Negative,
+	}
+	if vp.Gattai != nil {
+		doc.Gattai = strings.Fields(gattaiDirective(vp.Gattai))[1:]
+	}
+	if vp.Regions != nil {
+		doc.Regions = vp.regionRows()
+	}
+	if vp.Attrs != nil {
+		doc.Overlay = strings.Fields(vp.Attrs.String())
+	}
+	for _, cage := range vp.Cages {
+		doc.Cages = append(doc.Cages, jsonCage{Sum: cage.Sum, Cells: cells(cage.Cells)})
+	}
+	for _, x := range vp.Relations {
+		doc.Dots = append(doc.Dots, jsonDot{Kind: x.Kind, Cells: cells([]int{x.A, x.B})})
+	}
+	for _, x := range vp.Lines {
+		doc.Lines = append(doc.Lines, jsonLine{Kind: x.Kind, Cells: cells(x.Cells)})
+	}
+	for _, x := range vp.Outside {
+		//指令是 "<种类> <位置> [方向] <值>"
+		fields := strings.Fields(x.Directive(l))
+		clue := jsonOutside{Kind: x.Kind, Position: fields[1], Value: x.Value}
+		if len(fields) == 4 {
+			clue.Direction = fields[2]
+		}
+		doc.Outside = append(doc.Outside, clue)
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
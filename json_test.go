@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestVariantJSONRoundTrip(t *testing.T) {
+	files, err := filepath.Glob("puzzles/*.txt")
+	check(err)
+	for _, filename := range files {
+		raw, err := os.ReadFile(filename)
+		check(err)
+		vp, err := ParseVariantPuzzle(string(raw))
+		check(err)
+		data, err := vp.JSON()
+		check(err)
+		parsed, err := ParseVariantJSON(data)
+		if err != nil {
+			t.Fatalf("%s：%v\n%s", filename, err, data)
+		}
+		if parsed.String() != vp.String() {
+			t.Fatalf("%s：JSON 导入后与原谜题不同\n%s\n%s", filename, parsed.String(), vp.String())
+		}
+		data2, err := parsed.JSON()
+		check(err)
+		if string(data2) != string(data) {
+			t.Fatalf("%s：再次导出的 JSON 不同", filename)
+		}
+	}
+}
+
+func TestVariantJSONFile(t *testing.T) {
+	raw, err := os.ReadFile("puzzles/killer-01.json")
+	check(err)
+	vp, err := ParseVariantJSON(raw)
+	check(err)
+	if vp.Info.Title != "杀手数独 01" || vp.Info.Source == "" {
+		t.Fatalf("元数据解析错误：%+v", vp.Info)
+	}
+	text, err := os.ReadFile("puzzles/killer-01.txt")
+	check(err)
+	killer, err := ParseVariantPuzzle(string(text))
+	check(err)
+	if !slices.Equal(vp.Givens, killer.Givens) || !reflect.DeepEqual(vp.Cages, killer.Cages) {
+		t.Fatalf("killer-01.json 与 killer-01.txt 不是同一个谜题")
+	}
+	data, err := vp.JSON()
+	check(err)
+	if string(data)+"\n" != string(raw) {
+		t.Fatalf("导出的 JSON 与文件不同：\n%s", data)
+	}
+
+	//元数据在文本格式中是指令
+	parsed, err := ParseVariantPuzzle(vp.String())
+	check(err)
+	if parsed.Info != vp.Info {
+		t.Fatalf("文本格式的元数据不一致：%+v", parsed.Info)
+	}
+}
+
+// schemaEnum 返回 JSON Schema 中 path 处的 enum
+func schemaEnum(schema map[string]any, path ...string) []string {
+	node := any(schema)
+	for _, key := range path {
+		node = node.(map[string]any)[key]
+	}
+	var values []string
+	for _, v := range node.(map[string]any)["enum"].([]any) {
+		values = append(values, v.(string))
+	}
+	slices.Sort(values)
+	return values
+}
+
+func TestPuzzleSchema(t *testing.T) {
+	var schema map[string]any
+	check(json.Unmarshal([]byte(PuzzleSchema), &schema))
+
+	//schema 的属性与 jsonPuzzle 的字段一致
+	properties := schema["properties"].(map[string]any)
+	var fields []string
+	typ := reflect.TypeFor[jsonPuzzle]()
+	for i := range typ.NumField() {
+		name, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+		fields = append(fields, name)
+		if properties[name] == nil {
+			t.Fatalf("schema 没有属性 %s", name)
+		}
+	}
+	if len(fields) != len(properties) {
+		t.Fatalf("schema 有 %d 个属性，jsonPuzzle 有 %d 个字段", len(properties), len(fields))
+	}
+
+	//枚举值与各种约束的种类一致
+	var relations []string
+	for kind := range relationKinds {
+		relations = append(relations, kind)
+	}
+	slices.Sort(relations)
+	for _, tc := range []struct {
+		path []string
+		want []string
+	}{
+		{[]string{"properties", "variants", "items"}, VariantNames()},
+		{[]string{"properties", "negative", "items"}, NegativeGroups()},
+		{[]string{"properties", "dots", "items", "properties", "kind"}, relations},
+		{[]string{"properties", "lines", "items", "properties", "kind"}, LineNames()},
+		{[]string{"properties", "outside", "items", "properties", "kind"}, OutsideNames()},
+	} {
+		if got := schemaEnum(schema, tc.path...); !slices.Equal(got, tc.want) {
+			t.Fatalf("schema 的 %v 是 %v，应该是 %v", tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestParseVariantJSON(t *testing.T) {
+	givens := `"givens": [".........", ".........", ".........", ".........", ".........", ".........", ".........", ".........", "........."]`
+	for _, tc := range []struct {
+		doc string
+		//错误信息中应该包含的内容
+		want string
+	}{
+		{`{` + givens + `, "unknown": 1}`, "unknown"},
+		{`{` + givens + `, "rows": 21}`, "size"},
+		{`{` + givens + `, "cages": [{"sum": 10, "cells": ["r1c1", "r10c1"]}]}`, "cages[0]"},
+		{`{` + givens + `, "dots": [{"kind": "red", "cells": ["r1c1", "r1c2"]}]}`, "dots[0]"},
+		{`{` + givens + `, "lines": [{"kind": "thermo", "cells": ["r1c1", "r1c3"]}]}`, "lines[0]"},
+		{`{` + givens + `, "outside": [{"kind": "sandwich", "position": "r1c1", "value": 5}]}`, "outside[0]"},
+		{`{"givens": ["........."]}`, "givens"},
+	} {
+		_, err := ParseVariantJSON([]byte(tc.doc))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("%s：错误应该包含 %q，实际是 %v", tc.doc, tc.want, err)
+		}
+	}
+}
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"fmt"
+	"math/bits"
+	"math/rand"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Constraint 是房以外的约束，VariantSolver 在唯一数、唯一位置和区块排除之后反复调用 Propagate，直到没有新的排除；
+// Situation 设置了 VariantRules 时，在没有待填的数之后同样反复调用，见 Board
+type Constraint interface {
+	// Propagate 根据局势 g 排除不可能的候选数（g.Exclude），返回是否有新的排除。
+	// 约束不可能满足时，排除所有相关的候选数，或者调用 g.fail 记录矛盾。
+	Propagate(g Board) bool
+	// Directive 返回约束在谜题文件中的指令
+	Directive(l *Layout) string
+}
+
+// Cage 是杀手数独的笼子：笼内的数字互不相同，和为 Sum
+type Cage struct {
+	Sum   int
+	Cells []int
+}
+
+// cageCombos[size][sum] 是 size 个不同数字（1~9）和为 sum 的所有组合，每个组合是数字的掩码
+var cageCombos = func() (combos [10][46][]int16) {
+	for mask := range int16(512) {
+		sum := 0
+		for n := range 9 {
+			if mask&(1<<n) != 0 {
+				sum += n + 1
+			}
+		}
+		size := bits.OnesCount16(uint16(mask))
+		combos[size][sum] = append(combos[size][sum], mask)
+	}
+	return
+}()
+
+func (cage *Cage) Propagate(g Board) bool {
+	return propagateSum(g, cage.Cells, cage.Sum, true, "笼子")
+}
+
+func (cage *Cage) Directive(l *Layout) string {
+	return fmt.Sprintf("cage %d %s", cage.Sum, formatCells(l, cage.Cells))
+}
+
+// validate 检查笼子的大小和组合
+func (cage *Cage) validate() error {
+	size := len(cage.Cells)
+	if size == 0 || size > 9 {
+		return fmt.Errorf("cage should have 1~9 cells, got %d", size)
+	}
+	if cage.Sum < 1 || cage.Sum > 45 || len(cageCombos[size][cage.Sum]) == 0 {
+		return fmt.Errorf("no combination of %d different digits sums to %d", size, cage.Sum)
+	}
+	return nil
+}
+
+// sumRule 要求单元格的和为 sum，由杀手数独的内侧、外侧规则生成。
+// distinct 为 true 时单元格互不相同（同一个房内），用数字组合排除；否则只用上下界排除。
+type sumRule struct {
+	name     string
+	cells    []int
+	sum      int
+	distinct bool
+}
+
+func (x *sumRule) Propagate(g Board) bool {
+	return propagateSum(g, x.cells, x.sum, x.distinct, x.name)
+}
+
+func (x *sumRule) Directive(l *Layout) string {
+	return fmt.Sprintf("# %s：%s 的和为 %d", x.name, formatCells(l, x.cells), x.sum)
+}
+
+// propagateSum 按单元格的和为 sum 排除候选数，返回是否有新的排除。
+// distinct 为 true 时按数字组合排除（见 propagateCombos）；否则按上下界排除。
+func propagateSum(g Board, cells []int, sum int, distinct bool, name string) bool {
+	if distinct {
+		if sum < 1 || sum > 45 || len(cells) > 9 {
+			g.fail("%s %s 的和不可能为 %d", name, formatCells(g.Layout(), cells), sum)
+			return true
+		}
+		changed, ok := propagateCombos(g, cells, cageCombos[len(cells)][sum])
+		if !ok {
+			g.fail("%s %s 的和不可能为 %d", name, formatCells(g.Layout(), cells), sum)
+			return true
+		}
+		return changed
+	}
+
+	//上下界：每个单元格的数不能小于 sum 减去其他单元格的最大值，也不能大于 sum 减去其他单元格的最小值
+	minSum, maxSum := 0, 0
+	for _, i := range cells {
+		minSum += minDigit(g.Candidates(i))
+		maxSum += maxDigit(g.Candidates(i))
+	}
+	if minSum > sum || maxSum < sum {
+		g.fail("%s %s 的和不可能为 %d", name, formatCells(g.Layout(), cells), sum)
+		return true
+	}
+	changed := false
+	for _, i := range cells {
+		lo := sum - (maxSum - maxDigit(g.Candidates(i)))
+		hi := sum - (minSum - minDigit(g.Candidates(i)))
+		for n := range int8(9) {
+			if (int(n)+1 < lo || int(n)+1 > hi) && g.Exclude(i, n) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// propagateCombos 只保留与已填的数和其他单元格的候选数相容的组合中的数字，cells 互不相同，combos 是数字组合的掩码；
+// 所有组合都必须出现的数字只有一个单元格可以填时，这个单元格排除其他数字。没有相容的组合时 ok 为 false。
+func propagateCombos(g Board, cells []int, combos []int16) (changed, ok bool) {
+	var filled int16
+	for _, i := range cells {
+		if n := g.Get(i); n >= 0 {
+			filled |= 1 << n
+		}
+	}
+	//allowed 是所有可行组合中未填的数字，required 是所有可行组合都有的未填的数字
+	var allowed int16
+	required := int16(511)
+	found := false
+	for _, combo := range combos {
+		if combo&filled != filled {
+			continue
+		}
+		rest := combo &^ filled
+		var union int16
+		fits := true
+		for _, i := range cells {
+			if g.Get(i) >= 0 {
+				continue
+			}
+			m := g.Candidates(i) & rest
+			if m == 0 {
+				fits = false
+				break
+			}
+			union |= m
+		}
+		if fits && union == rest {
+			allowed |= rest
+			required &= rest
+			found = true
+		}
+	}
+	if !found {
+		return false, false
+	}
+	for _, i := range cells {
+		if g.Get(i) >= 0 {
+			continue
+		}
+		for n := range int8(9) {
+			if allowed&(1<<n) == 0 && g.Exclude(i, n) {
+				changed = true
+			}
+		}
+	}
+	//必须出现的数字只有一个单元格可以填时，这个单元格排除其他数字
+	for n := range int8(9) {
+		if required&(1<<n) == 0 {
+			continue
+		}
+		place, places := -1, 0
+		for _, i := range cells {
+			if g.Get(i) < 0 && g.Candidates(i)&(1<<n) != 0 {
+				place = i
+				places++
+			}
+		}
+		if places != 1 {
+			continue
+		}
+		for n0 := range int8(9) {
+			if n0 != n && g.Exclude(place, n0) {
+				changed = true
+			}
+		}
+	}
+	return changed, true
+}
+
+// minDigit 返回候选数掩码中最小的数字（1~9），没有候选数时返回 10
+func minDigit(mask int16) int {
+	return bits.TrailingZeros16(uint16(mask)) + 1
+}
+
+// maxDigit 返回候选数掩码中最大的数字（1~9），没有候选数时返回 0
+func maxDigit(mask int16) int {
+	return 16 - bits.LeadingZeros16(uint16(mask))
+}
+
+// killerRules 按 45 规则生成内侧、外侧的求和约束：
+// 每个房的和为 45，减去完全在房内的笼子，剩下的单元格（内侧）的和是已知的；
+// 房被笼子完全覆盖时，与房相交的笼子的和减去 45，是这些笼子在房外的单元格（外侧）的和。
+// 只生成不超过 4 个单元格的约束，更大的约束排除能力很弱。
+func killerRules(l *Layout, cages []Cage) []Constraint {
+	cageOf := make([]int, l.Size())
+	for i := range cageOf {
+		cageOf[i] = -1
+	}
+	for k, cage := range cages {
+		for _, i := range cage.Cells {
+			cageOf[i] = k
+		}
+	}
+	const maxCells = 4
+	var rules []Constraint
+	for _, house := range l.Houses {
+		inHouse := make(map[int]bool)
+		for _, i := range house.Cells {
+			inHouse[i] = true
+		}
+		//与房相交的笼子，以及它们是否完全在房内
+		touched := make(map[int]bool)
+		covered := true
+		for _, i := range house.Cells {
+			if cageOf[i] < 0 {
+				covered = false
+			} else {
+				touched[cageOf[i]] = true
+			}
+		}
+		var touchedCages []int
+		for k := range touched {
+			touchedCages = append(touchedCages, k)
+		}
+		sort.Ints(touchedCages)
+
+		innerSum, touchedSum := 0, 0
+		var innies, outies []int
+		for _, i := range house.Cells {
+			if k := cageOf[i]; k < 0 || !cageInside(cages[k], inHouse) {
+				innies = append(innies, i)
+			}
+		}
+		for _, k := range touchedCages {
+			touchedSum += cages[k].Sum
+			if cageInside(cages[k], inHouse) {
+				innerSum += cages[k].Sum
+				continue
+			}
+			for _, i := range cages[k].Cells {
+				if !inHouse[i] {
+					outies = append(outies, i)
+				}
+			}
+		}
+		if len(innies) > 0 && len(innies) <= maxCells {
+			rules = append(rules, &sumRule{
+				name:     house.Name + "内侧",
+				cells:    innies,
+				sum:      45 - innerSum,
+				distinct: true,
+			})
+		}
+		if covered && len(outies) > 0 && len(outies) <= maxCells {
+			rules = append(rules, &sumRule{
+				name:  house.Name + "外侧",
+				cells: outies,
+				sum:   touchedSum - 45,
+			})
+		}
+	}
+	return rules
+}
+
+func cageInside(cage Cage, inHouse map[int]bool) bool {
+	for _, i := range cage.Cells {
+		if !inHouse[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// GenerateKiller 随机生成一个有唯一解的杀手数独：先随机生成终局，再把单元格随机分成大多为 2~5 格的笼子，
+// 只有笼子不能确定唯一解时，才从终局中加入已知数。
+func GenerateKiller(rnd *rand.Rand) *VariantPuzzle {
+	cells, _ := SampleSolution(NewSituation(), NewTrigger(), rnd)
+	solution := make([]int8, 81)
+	for i := range solution {
+		solution[i] = cells[i/9][i%9]
+	}
+
+	//随机生长笼子：从未分配的单元格开始，加入相邻的、数字不重复的未分配单元格
+	cageOf := make([]int, 81)
+	for i := range cageOf {
+		cageOf[i] = -1
+	}
+	var cages []Cage
+	var used []int16
+	neighbors := func(i int) []int {
+		var result []int
+		for _, j := range [4]int{i - 9, i + 9, i - 1, i + 1} {
+			if j >= 0 && j < 81 && (j/9 == i/9 || j%9 == i%9) {
+				result = append(result, j)
+			}
+		}
+		return result
+	}
+	addCell := func(k, i int) {
+		cageOf[i] = k
+		used[k] |= 1 << solution[i]
+		cages[k].Cells = append(cages[k].Cells, i)
+		cages[k].Sum += int(solution[i]) + 1
+	}
+	for _, start := range rnd.Perm(81) {
+		if cageOf[start] >= 0 {
+			continue
+		}
+		k := len(cages)
+		cages = append(cages, Cage{})
+		used = append(used, 0)
+		addCell(k, start)
+		size := 2 + rnd.Intn(4)
+		for len(cages[k].Cells) < size {
+			var next []int
+			for _, i := range cages[k].Cells {
+				for _, j := range neighbors(i) {
+					if cageOf[j] < 0 && used[k]&(1<<solution[j]) == 0 {
+						next = append(next, j)
+					}
+				}
+			}
+			if len(next) == 0 {
+				break
+			}
+			addCell(k, next[rnd.Intn(len(next))])
+		}
+	}
+	//只有一个单元格的笼子等于已知数，尽量并入相邻的笼子
+	for k := range cages {
+		if len(cages[k].Cells) != 1 {
+			continue
+		}
+		i := cages[k].Cells[0]
+		for _, j := range neighbors(i) {
+			k2 := cageOf[j]
+			if k2 != k && len(cages[k2].Cells) < 6 && used[k2]&(1<<solution[i]) == 0 {
+				cages[k] = Cage{}
+				addCell(k2, i)
+				break
+			}
+		}
+	}
+	cages = slices.DeleteFunc(cages, func(cage Cage) bool { return len(cage.Cells) == 0 })
+	for k := range cages {
+		sort.Ints(cages[k].Cells)
+	}
+
+	vp := &VariantPuzzle{Givens: make([]int8, 81), Cages: cages}
+	for i := range vp.Givens {
+		vp.Givens[i] = -1
+	}
+	for {
+		var found [][]int8
+		_, err := vp.Run(NewSudokuContext(), func(g *Grid) bool {
+			found = append(found, append([]int8(nil), g.cells...))
+			return len(found) < 2
+		})
+		check(err)
+		if len(found) < 2 {
+			return vp
+		}
+		//加入两个解不同的第一个单元格
+		for i := range found[1] {
+			if found[0][i] != found[1][i] {
+				vp.Givens[i] = solution[i]
+				break
+			}
+		}
+	}
+}
+
+// formatCells 返回单元格列表的文本形式，例如 "r1c1 r1c2"
+func formatCells(l *Layout, cells []int) string {
+	var sb strings.Builder
+	for k, i := range cells {
+		if k > 0 {
+			sb.WriteByte(' ')
+		}
+		r, c := l.RowCol(i)
+		fmt.Fprintf(&sb, "r%dc%d", r+1, c+1)
+	}
+	return sb.String()
+}
+
+// parseCell 解析 "r1c2" 形式的单元格，返回单元格编号
+func parseCell(l *Layout, token string) (int, error) {
+	var r, c int
+	var rest string
+	n, _ := fmt.Sscanf(strings.ToLower(token), "r%dc%d%s", &r, &c, &rest)
+	if n != 2 || r < 1 || r > l.Rows || c < 1 || c > l.Cols {
+		return 0, fmt.Errorf("invalid cell %q", token)
+	}
+	if !l.Present(l.Index(r-1, c-1)) {
+		return 0, fmt.Errorf("cell %q is not on any grid", token)
+	}
+	return l.Index(r-1, c-1), nil
+}
+
+// parseCells 解析多个单元格，单元格不能重复
+func parseCells(l *Layout, tokens []string) ([]int, error) {
+	var cells []int
+	seen := make(map[int]bool)
+	for _, token := range tokens {
+		i, err := parseCell(l, token)
+		if err != nil {
+			return nil, err
+		}
+		if seen[i] {
+			return nil, fmt.Errorf("duplicate cell %s", token)
+		}
+		seen[i] = true
+		cells = append(cells, i)
+	}
+	return cells, nil
+}
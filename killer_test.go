@@ -0,0 +1,100 @@
+package main
+
+import (
+	"math/rand"
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestCageCombos(t *testing.T) {
+	if combos := cageCombos[2][3]; len(combos) != 1 || combos[0] != 0b11 {
+		t.Fatalf("两格和为 3 只能是 1+2：%b", combos)
+	}
+	if combos := cageCombos[9][45]; len(combos) != 1 || combos[0] != 511 {
+		t.Fatalf("九格和为 45 只能是 1~9：%b", combos)
+	}
+	if len(cageCombos[3][5]) != 0 {
+		t.Fatalf("三个不同数字的和不可能为 5")
+	}
+	if len(cageCombos[2][10]) != 4 {
+		t.Fatalf("两格和为 10 有 4 种组合：%b", cageCombos[2][10])
+	}
+}
+
+// checkKiller 检查解满足所有笼子和由笼子生成的内侧、外侧规则
+func checkKiller(t *testing.T, vp *VariantPuzzle, g *Grid) {
+	for _, c := range vp.Constraints() {
+		var cells []int
+		sum := 0
+		switch x := c.(type) {
+		case *Cage:
+			cells, sum = x.Cells, x.Sum
+		case *sumRule:
+			cells, sum = x.cells, x.sum
+		default:
+			continue
+		}
+		total := 0
+		for _, i := range cells {
+			total += int(g.Get(i)) + 1
+		}
+		if total != sum {
+			t.Fatalf("%s 的和为 %d", c.Directive(g.Layout()), total)
+		}
+	}
+}
+
+func TestKillerPuzzle(t *testing.T) {
+	raw, err := os.ReadFile("puzzles/killer-01.txt")
+	check(err)
+	vp, err := ParseVariantPuzzle(string(raw))
+	check(err)
+	if len(vp.Cages) == 0 || len(vp.Constraints()) <= len(vp.Cages) {
+		t.Fatalf("应该有笼子以及内侧、外侧规则：%d 个笼子，%d 个约束", len(vp.Cages), len(vp.Constraints()))
+	}
+	count, err := vp.Run(NewSudokuContext(), func(g *Grid) bool {
+		checkKiller(t, vp, g)
+		return true
+	})
+	check(err)
+	if count != 1 {
+		t.Fatalf("应该有唯一解，找到 %d 个", count)
+	}
+}
+
+func TestGenerateKiller(t *testing.T) {
+	vp := GenerateKiller(rand.New(rand.NewSource(3)))
+	count, err := vp.Run(NewSudokuContext(), func(g *Grid) bool {
+		checkKiller(t, vp, g)
+		return true
+	})
+	check(err)
+	if count != 1 {
+		t.Fatalf("生成的谜题应该有唯一解，找到 %d 个", count)
+	}
+
+	parsed, err := ParseVariantPuzzle(vp.String())
+	check(err)
+	if !slices.Equal(parsed.Givens, vp.Givens) || len(parsed.Cages) != len(vp.Cages) {
+		t.Fatalf("导出后重新解析不一致：\n%s", vp.String())
+	}
+	for k := range vp.Cages {
+		if parsed.Cages[k].Sum != vp.Cages[k].Sum || !slices.Equal(parsed.Cages[k].Cells, vp.Cages[k].Cells) {
+			t.Fatalf("第 %d 个笼子不一致", k+1)
+		}
+	}
+}
+
+func TestParseCage(t *testing.T) {
+	for _, bad := range []string{
+		"cage 3 r1c1 r1c2 r1c3\n" + multiSolutionPuzzle,
+		"cage x r1c1\n" + multiSolutionPuzzle,
+		"cage 3 r1c1 r1c2\ncage 4 r1c2 r1c3\n" + multiSolutionPuzzle,
+		"cage 3 r1c1 r0c2\n" + multiSolutionPuzzle,
+	} {
+		if _, err := ParseVariantPuzzle(bad); err == nil {
+			t.Fatalf("应该返回错误：%q", bad)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Line 是线约束：温度计、箭头、回文线、德国耳语线或者连续线（renban）
+type Line struct {
+	//线的种类，见 lineKinds
+	Kind string
+	//线按顺序经过的单元格，温度计的第一个单元格是泡，箭头的第一个单元格是圆圈
+	Cells []int
+}
+
+// lineKind 是一种线的规则
+type lineKind struct {
+	name string
+	//distinct 为 true 时线上的数字互不相同，单元格互为同伴
+	distinct bool
+	//maxCells 是线最多经过的单元格数，0 表示不限
+	maxCells  int
+	propagate func(g Board, cells []int) bool
+}
+
+// lineKinds 是所有线的种类，种类名同时是谜题文件中的指令，例如 thermo r1c1 r1c2 r1c3
+var lineKinds = map[string]lineKind{
+	"thermo":     {"温度计", true, 9, propagateThermo},
+	"arrow":      {"箭头", false, 0, propagateArrow},
+	"palindrome": {"回文线", false, 0, propagatePalindrome},
+	"whisper":    {"德国耳语线", false, 0, propagateWhisper},
+	"renban":     {"连续线", true, 9, propagateRenban},
+}
+
+func init() {
+	for kind := range lineKinds {
+		variantDirectives[kind] = func(p *variantParser, args []string) error {
+			cells, err := parseCells(p.shape, args)
+			if err != nil {
+				return fmt.Errorf("%s: %w", kind, err)
+			}
+			line := Line{Kind: kind, Cells: cells}
+			if err := line.validate(p.shape); err != nil {
+				return fmt.Errorf("%s: %w", kind, err)
+			}
+			p.vp.Lines = append(p.vp.Lines, line)
+			return nil
+		}
+	}
+}
+
+// LineNames 返回所有线的种类
+func LineNames() []string {
+	var names []string
+	for name := range lineKinds {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func (x *Line) Propagate(g Board) bool {
+	return lineKinds[x.Kind].propagate(g, x.Cells)
+}
+
+func (x *Line) Directive(l *Layout) string {
+	return fmt.Sprintf("%s %s", x.Kind, formatCells(l, x.Cells))
+}
+
+// validate 检查线的长度，以及相邻的单元格是否上下左右或者斜向相邻
+func (x *Line) validate(l *Layout) error {
+	kind := lineKinds[x.Kind]
+	if len(x.Cells) < 2 {
+		return fmt.Errorf("line should have at least 2 cells")
+	}
+	if kind.maxCells > 0 && len(x.Cells) > kind.maxCells {
+		return fmt.Errorf("%s should have at most %d cells, got %d", kind.name, kind.maxCells, len(x.Cells))
+	}
+	for k := 1; k < len(x.Cells); k++ {
+		r1, c1 := l.RowCol(x.Cells[k-1])
+		r2, c2 := l.RowCol(x.Cells[k])
+		if max(r1-r2, r2-r1, c1-c2, c2-c1) != 1 {
+			return fmt.Errorf("cells %s and %s are not adjacent", l.CellName(x.Cells[k-1]), l.CellName(x.Cells[k]))
+		}
+	}
+	return nil
+}
+
+// excludeOutside 从单元格 i 排除 lo~hi（1~9）以外的数，返回是否有新的排除
+func excludeOutside(g Board, i int, lo, hi int) bool {
+	changed := false
+	for n := range int8(9) {
+		if (int(n)+1 < lo || int(n)+1 > hi) && g.Exclude(i, n) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+// propagateThermo 温度计从泡开始严格递增：每个单元格大于前一个单元格的最小值，小于后一个单元格的最大值
+func propagateThermo(g Board, cells []int) bool {
+	changed := false
+	lo := 0
+	for _, i := range cells {
+		if excludeOutside(g, i, lo+1, 9) {
+			changed = true
+		}
+		lo = minDigit(g.Candidates(i))
+	}
+	hi := 10
+	for k := len(cells) - 1; k >= 0; k-- {
+		if excludeOutside(g, cells[k], 1, hi-1) {
+			changed = true
+		}
+		hi = maxDigit(g.Candidates(cells[k]))
+	}
+	return changed
+}
+
+// propagateArrow 圆圈（第一个单元格）的数等于箭头上其他单元格的和，箭头上的数可以重复：
+// 圆圈在箭头的和的上下界之内，箭头上每个单元格不超过圆圈的最大值减去其他单元格的最小值，以此类推
+func propagateArrow(g Board, cells []int) bool {
+	circle, arrow := cells[0], cells[1:]
+	minSum, maxSum := 0, 0
+	for _, i := range arrow {
+		minSum += minDigit(g.Candidates(i))
+		maxSum += maxDigit(g.Candidates(i))
+	}
+	changed := excludeOutside(g, circle, minSum, maxSum)
+	lo, hi := minDigit(g.Candidates(circle)), maxDigit(g.Candidates(circle))
+	for _, i := range arrow {
+		mask := g.Candidates(i)
+		if excludeOutside(g, i, lo-(maxSum-maxDigit(mask)), hi-(minSum-minDigit(mask))) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+var (
+	//回文线上对称的两个单元格相同
+	palindromeTable = newPairTable(func(x, y int) bool { return x == y })
+	//德国耳语线上相邻的两个单元格相差至少 5
+	whisperTable = newPairTable(func(x, y int) bool { return x-y >= 5 || y-x >= 5 })
+	//renbanCombos[size] 是 size 个连续数字的所有组合
+	renbanCombos = func() (combos [10][]int16) {
+		for size := 1; size <= 9; size++ {
+			for lo := 0; lo+size <= 9; lo++ {
+				combos[size] = append(combos[size], int16((1<<size-1)<<lo))
+			}
+		}
+		return
+	}()
+)
+
+// propagatePalindrome 回文线正着读和倒着读相同
+func propagatePalindrome(g Board, cells []int) bool {
+	changed := false
+	for k := range len(cells) / 2 {
+		if palindromeTable.propagate(g, cells[k], cells[len(cells)-1-k]) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+// propagateWhisper 德国耳语线上相邻的单元格相差至少 5，所以线上不能有 5
+func propagateWhisper(g Board, cells []int) bool {
+	changed := false
+	for k := 1; k < len(cells); k++ {
+		if whisperTable.propagate(g, cells[k-1], cells[k]) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+// propagateRenban 连续线上的数字互不相同，是一组连续的数字，顺序任意
+func propagateRenban(g Board, cells []int) bool {
+	changed, ok := propagateCombos(g, cells, renbanCombos[len(cells)])
+	if !ok {
+		g.fail("连续线 %s 不能填入连续的数字", formatCells(g.Layout(), cells))
+		return true
+	}
+	return changed
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// digits 返回候选数掩码中的数字（1~9）
+func digits(mask int16) []int {
+	var result []int
+	for n := range 9 {
+		if mask&(1<<n) != 0 {
+			result = append(result, n+1)
+		}
+	}
+	return result
+}
+
+func TestPropagateLines(t *testing.T) {
+	cases := []struct {
+		directive string
+		//填入的已知数（1~9），键是单元格编号
+		givens map[int]int8
+		//检查的单元格和它的候选数
+		cell int
+		want []int
+	}{
+		{"thermo r1c1 r2c2 r3c3", nil, 0, []int{1, 2, 3, 4, 5, 6, 7}},
+		{"thermo r1c1 r2c2 r3c3", nil, 20, []int{3, 4, 5, 6, 7, 8, 9}},
+		{"thermo r1c1 r2c2 r3c3", map[int]int8{0: 6}, 10, []int{7, 8}},
+		//箭头只用上下界排除，不考虑箭头上的数互不相同
+		{"arrow r1c1 r2c2 r3c3", nil, 0, []int{2, 3, 4, 5, 6, 7, 8, 9}},
+		{"arrow r1c1 r2c2 r3c3", map[int]int8{0: 3}, 20, []int{1, 2}},
+		{"arrow r1c1 r2c2 r3c3", map[int]int8{0: 9, 10: 2}, 20, []int{7}},
+		{"palindrome r3c3 r4c4 r5c5", map[int]int8{20: 4}, 40, []int{4}},
+		{"whisper r1c1 r2c2", nil, 0, []int{1, 2, 3, 4, 6, 7, 8, 9}},
+		{"whisper r1c1 r2c2", map[int]int8{0: 3}, 10, []int{8, 9}},
+		{"renban r1c1 r2c2 r3c3", map[int]int8{0: 1}, 10, []int{2, 3}},
+		{"renban r1c1 r2c2 r3c3", map[int]int8{0: 5, 20: 7}, 10, []int{6}},
+	}
+	for _, tc := range cases {
+		vp, err := ParseVariantPuzzle(tc.directive + "\n" + strings.Repeat(".........\n", 9))
+		check(err)
+		g := NewGrid(vp.Layout())
+		for i, n := range tc.givens {
+			g.Set(i, n-1)
+		}
+		for applyConstraints(g, vp) && g.Conflict() == "" {
+		}
+		if g.Conflict() != "" {
+			t.Fatalf("%s：%s", tc.directive, g.Conflict())
+		}
+		if got := digits(g.Candidates(tc.cell)); !slices.Equal(got, tc.want) {
+			t.Fatalf("%s：%s 的候选数为 %v，应该是 %v", tc.directive, vp.Layout().CellName(tc.cell), got, tc.want)
+		}
+	}
+}
+
+func TestLinePuzzleFiles(t *testing.T) {
+	for _, name := range LineNames() {
+		filename := "puzzles/" + name + "-01.txt"
+		raw, err := os.ReadFile(filename)
+		check(err)
+		vp, err := ParseVariantPuzzle(string(raw))
+		check(err)
+		if len(vp.Lines) == 0 {
+			t.Fatalf("%s 没有线", filename)
+		}
+		count, err := vp.Run(NewSudokuContext(), func(g *Grid) bool {
+			//填满的盘面上，线约束不应该再排除任何候选数
+			for _, x := range vp.Lines {
+				if x.Propagate(g) || g.Conflict() != "" {
+					t.Fatalf("%s：%s 不成立", filename, x.Directive(g.Layout()))
+				}
+			}
+			return true
+		})
+		check(err)
+		if count != 1 {
+			t.Fatalf("%s 应该有唯一解，找到 %d 个", filename, count)
+		}
+
+		parsed, err := ParseVariantPuzzle(vp.String())
+		check(err)
+		if len(parsed.Lines) != len(vp.Lines) {
+			t.Fatalf("%s：导出后重新解析不一致", filename)
+		}
+		for k := range vp.Lines {
+			if parsed.Lines[k].Kind != vp.Lines[k].Kind || !slices.Equal(parsed.Lines[k].Cells, vp.Lines[k].Cells) {
+				t.Fatalf("%s：第 %d 条线不一致", filename, k+1)
+			}
+		}
+	}
+}
+
+func TestParseLine(t *testing.T) {
+	for _, bad := range []string{
+		"thermo r1c1\n" + multiSolutionPuzzle,
+		"thermo r1c1 r1c3\n" + multiSolutionPuzzle,
+		"thermo r1c1 r1c2 r1c3 r1c4 r1c5 r1c6 r1c7 r1c8 r1c9 r2c9\n" + multiSolutionPuzzle,
+		"arrow r1c1 r1c1\n" + multiSolutionPuzzle,
+		"renban r1c1 r0c2\n" + multiSolutionPuzzle,
+	} {
+		if _, err := ParseVariantPuzzle(bad); err == nil {
+			t.Fatalf("应该返回错误：%q", bad)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -14,12 +15,24 @@ var (
 	flagShowStat            = flag.Bool("stat", false, "显示运算统计信息")
 	flagShowBranch          = flag.Bool("branch", false, "显示分支结构")
 	flagGensApplyRules      = flag.Int("gens-apply-rules", 0, "在N代分支内使用复杂排除规则")
+	flagAdaptiveRules       = flag.Bool("adaptive-rules", false, "按每类复杂排除规则的收益和耗时动态启用或关闭规则")
+	flagIterative           = flag.Bool("iterative", false, "使用显式栈和撤销记录的迭代搜索，分支时不复制局势")
+	flagParallel            = flag.Int("parallel", 1, "用N个线程搜索同一个谜题")
+	flagStrategy            = flag.String("strategy", "default", fmt.Sprintf("分支策略 %v", BranchStrategyNames()))
+	flagSeed                = flag.Int64("seed", 1, "random 分支策略的随机种子")
+	flagEngine              = flag.String("engine", "default", fmt.Sprintf("解题算法 %v", SolverEngineNames()))
+	flagMoves               = flag.String("moves", "", fmt.Sprintf("额外的排除规则，多个用逗号分隔 %v", MoveRuleNames()))
 )
 
 const MsgUsage = `使用方法：
 
-gosudoku <file> 从文件加载谜题
+gosudoku <file> 从文件加载谜题，谜题之后可以写 overlay 和9行覆盖层：e 偶数格，o 奇数格，f 堡垒格
 gosudoku        从标准输入获取谜题
+gosudoku canon  计算谜题的标准形式，或按标准形式去重（gosudoku canon -h 查看选项）
+gosudoku enum   逐个输出谜题的所有解，或随机抽取解（gosudoku enum -h 查看选项）
+gosudoku backbone 分析多解谜题每个单元格可能的数字
+gosudoku tune   在测试集上搜索分支启发式的参数（gosudoku tune -h 查看选项）
+gosudoku variant 求解对角线、窗口等变体数独（gosudoku variant -h 查看格式）
 
 `
 
@@ -30,35 +43,137 @@ func main() {
 	}
 	flag.Parse()
 
-	puzzle := loadPuzzle()
+	switch flag.Arg(0) {
+	case "canon":
+		runCanon(flag.Args()[1:])
+		return
+	case "enum":
+		runEnum(flag.Args()[1:])
+		return
+	case "backbone":
+		runBackbone(flag.Args()[1:])
+		return
+	case "tune":
+		runTune(flag.Args()[1:])
+		return
+	case "variant":
+		runVariant(flag.Args()[1:])
+		return
+	}
+
+	puzzle, attrs, err := SplitCellAttrs(loadPuzzle())
+	check(err)
+	var moveNames []string
+	if *flagMoves != "" {
+		moveNames = strings.Split(*flagMoves, ",")
+	}
+	moves, err := NewMoveRules(moveNames)
+	check(err)
+	if *flagEngine != "default" {
+		if moves != nil {
+			check(fmt.Errorf("-moves is only supported by the default engine"))
+		}
+		if attrs != nil {
+			check(fmt.Errorf("overlay is only supported by the default engine"))
+		}
+		runEngine(puzzle)
+		return
+	}
 	s, t := ParseSituation(puzzle)
+	s.SetMoveRules(t, moves)
+	s.SetCellAttrs(t, attrs)
+
+	ctx := newContextFromFlags()
+	startTime := time.Now()
+	count := ctx.Run(s, t)
+	dur := time.Since(startTime)
+	if count > 0 {
+		fmt.Printf("\n找到了 %d 个解\n", count)
+		for i, answer := range ctx.solutions {
+			ShowCells(answer, fmt.Sprintf("解 %d", i+1), -1, -1)
+		}
+	} else {
+		s.Show("失败", -1, -1)
+	}
+	if *flagShowStat {
+		showContextStat(ctx, dur)
+	}
+}
 
+// newContextFromFlags 按命令行选项创建 SudokuContext，求解和 variant 命令共用
+func newContextFromFlags() *SudokuContext {
+	strategy, err := NewBranchStrategy(*flagStrategy, *flagSeed)
+	check(err)
 	ctx := &SudokuContext{
 		ShowProcess:         *flagShowProcess,
 		ShowBranch:          *flagShowBranch,
 		StopAtFirstSolution: *flagStopAtFirstSolution,
 		GensApplyRules:      *flagGensApplyRules,
+		AdaptiveRules:       *flagAdaptiveRules,
+		Iterative:           *flagIterative,
+		Parallel:            *flagParallel,
+		Strategy:            strategy,
 	}
+	check(ctx.Validate())
+	return ctx
+}
+
+// showContextStat 显示 -stat 的统计信息，dur 是搜索的耗时
+func showContextStat(ctx *SudokuContext, dur time.Duration) {
+	var sumBranches int
+	for _, branches := range ctx.branchCount {
+		sumBranches += branches
+	}
+	fmt.Printf("总耗时：%v\n", dur)
+	fmt.Printf("二叉分支数：%d\n", ctx.branchCount[2])
+	fmt.Printf("多叉支数：%d\n", sumBranches-ctx.branchCount[2])
+	fmt.Printf("总演算次数 %d\n", ctx.evalCount)
+	if ctx.AdaptiveRules {
+		fmt.Printf("规则排除分支数：%d\n", ctx.rulesDebranch)
+		for _, st := range ctx.RuleStats() {
+			fmt.Println(st.String())
+		}
+	}
+}
+
+// runEngine 使用 -engine 指定的算法解题，不支持显示中间步骤和分支结构
+func runEngine(puzzle string) {
+	solver, err := NewSolver(*flagEngine)
+	check(err)
+	s, t := ParseSituation(puzzle)
+	givens := s.cells
+	ReleaseSituation(s)
+	ReleaseTrigger(t)
+	solveWithEngine(solver, &givens, func(cells *[9][9]int8, title string) {
+		ShowCells(cells, title, -1, -1)
+	})
+}
+
+// solveWithEngine 用 solver 求解 givens，show 显示解或失败时的谜题
+func solveWithEngine(solver Solver, givens *[9][9]int8, show func(cells *[9][9]int8, title string)) {
+	var solutions []*[9][9]int8
 	startTime := time.Now()
-	count := ctx.Run(s, t)
+	count := solver.Solve(givens, func(solution *[9][9]int8) bool {
+		cells := *solution
+		solutions = append(solutions, &cells)
+		return !*flagStopAtFirstSolution
+	})
 	dur := time.Since(startTime)
 	if count > 0 {
 		fmt.Printf("\n找到了 %d 个解\n", count)
-		for i, answer := range ctx.solutions {
-			ShowCells(answer, fmt.Sprintf("解 %d", i+1), -1, -1)
+		for i, answer := range solutions {
+			show(answer, fmt.Sprintf("解 %d", i+1))
 		}
 	} else {
-		s.Show("失败", -1, -1)
+		show(givens, "失败")
 	}
 	if *flagShowStat {
-		var sumBranches int
-		for _, branches := range ctx.branchCount {
-			sumBranches += branches
-		}
+		stats := solver.Stats()
+		fmt.Printf("算法：%s\n", *flagEngine)
 		fmt.Printf("总耗时：%v\n", dur)
-		fmt.Printf("二叉分支数：%d\n", ctx.branchCount[2])
-		fmt.Printf("多叉支数：%d\n", sumBranches-ctx.branchCount[2])
-		fmt.Printf("总演算次数 %d\n", ctx.evalCount)
+		fmt.Printf("二叉分支数：%d\n", stats.BranchCount[2])
+		fmt.Printf("多叉支数：%d\n", stats.SumBranches()-stats.BranchCount[2])
+		fmt.Printf("总演算次数 %d\n", stats.EvalCount)
 	}
 }
 
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// MoveRules 是行、列、宫之外按单元格的相对位置排除的规则，填数时与行、列、宫一起排除：
+// 反马步（anti-knight）、反王步（anti-king）从相隔国际象棋马步、王步的单元格排除同一个数，
+// 非连续（non-consecutive）从上下左右相邻的单元格排除相差 1 的数。
+type MoveRules struct {
+	Names []string
+	//peers[r][c] 是 (r,c) 在行、列、宫以外的同伴，不能填相同的数
+	peers [9][9][]RowCol
+	//不为 nil 时，neighbors[r][c] 是与 (r,c) 上下左右相邻的单元格，不能填相差 1 的数
+	neighbors *[9][9][]RowCol
+}
+
+var (
+	knightMoves   = []RowCol{{-2, -1}, {-2, 1}, {-1, -2}, {-1, 2}, {1, -2}, {1, 2}, {2, -1}, {2, 1}}
+	kingMoves     = []RowCol{{-1, -1}, {-1, 0}, {-1, 1}, {0, -1}, {0, 1}, {1, -1}, {1, 0}, {1, 1}}
+	adjacentMoves = []RowCol{{-1, 0}, {0, -1}, {0, 1}, {1, 0}}
+)
+
+// moveRules 是所有的规则，值是规则的相对位置
+var moveRules = map[string][]RowCol{
+	"anti-knight":     knightMoves,
+	"anti-king":       kingMoves,
+	"non-consecutive": adjacentMoves,
+}
+
+// MoveRuleNames 返回所有规则的名称
+func MoveRuleNames() []string {
+	var names []string
+	for name := range moveRules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewMoveRules 按名称创建规则，names 为空时返回 nil
+func NewMoveRules(names []string) (*MoveRules, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	m := &MoveRules{Names: names}
+	for _, name := range names {
+		moves, ok := moveRules[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown move rule %q, available: %v", name, MoveRuleNames())
+		}
+		if name == "non-consecutive" {
+			m.neighbors = new([9][9][]RowCol)
+			m.addMoves(m.neighbors, moves, false)
+		} else {
+			m.addMoves(&m.peers, moves, true)
+		}
+	}
+	return m, nil
+}
+
+// addMoves 把相隔 moves 的单元格加入 cells；sameDigit 为 true 时跳过已经同行、列、宫的单元格
+func (m *MoveRules) addMoves(cells *[9][9][]RowCol, moves []RowCol, sameDigit bool) {
+	for r := range int8(9) {
+		for c := range int8(9) {
+			b, _ := rcbp(r, c)
+			for _, move := range moves {
+				r0, c0 := r+move.Row, c+move.Col
+				if r0 < 0 || r0 >= 9 || c0 < 0 || c0 >= 9 {
+					continue
+				}
+				if b0, _ := rcbp(r0, c0); sameDigit && (r0 == r || c0 == c || b0 == b) {
+					continue
+				}
+				rc := RowCol{r0, c0}
+				if !slices.Contains(cells[r][c], rc) {
+					cells[r][c] = append(cells[r][c], rc)
+				}
+			}
+		}
+	}
+}
+
+// SetMoveRules 为局势启用规则，并对已填的数应用规则。m 为 nil 时不做任何事。
+func (s *Situation) SetMoveRules(t *Trigger, m *MoveRules) {
+	if m == nil {
+		return
+	}
+	s.moves = m
+	for r := range int8(9) {
+		for c := range int8(9) {
+			if n := s.cells[r][c]; n >= 0 {
+				s.applyMoveRules(t, r, c, n)
+			}
+		}
+	}
+}
+
+// applyMoveRules 在 (r,c) 填 n 之后，按规则排除其他单元格的候选数
+func (s *Situation) applyMoveRules(t *Trigger, r, c, n int8) {
+	for _, rc := range s.moves.peers[r][c] {
+		s.excludeOne(t, RCN(rc.Row, rc.Col, n))
+	}
+	if s.moves.neighbors == nil {
+		return
+	}
+	for _, rc := range s.moves.neighbors[r][c] {
+		if n > 0 {
+			s.excludeOne(t, RCN(rc.Row, rc.Col, n-1))
+		}
+		if n < 8 {
+			s.excludeOne(t, RCN(rc.Row, rc.Col, n+1))
+		}
+	}
+}
+
+var nonConsecutiveTable = newPairTable(func(x, y int) bool { return x-y != 1 && y-x != 1 })
+
+// apply 把规则加入变体数独的盘面：额外的同伴加入 Layout，非连续规则作为约束返回
+func (m *MoveRules) apply(l *Layout) []Constraint {
+	var rules []Constraint
+	for r := range int8(9) {
+		for c := range int8(9) {
+			i := l.Index(int(r), int(c))
+			for _, rc := range m.peers[r][c] {
+				l.addPeers([]int{i, l.Index(int(rc.Row), int(rc.Col))})
+			}
+			if m.neighbors == nil {
+				continue
+			}
+			for _, rc := range m.neighbors[r][c] {
+				if j := l.Index(int(rc.Row), int(rc.Col)); i < j {
+					rules = append(rules, &pairRule{name: "非连续", a: i, b: j, table: nonConsecutiveTable})
+				}
+			}
+		}
+	}
+	return rules
+}
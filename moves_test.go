@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+// moveClauses 返回规则的 SAT 子句，用于交叉检验
+func moveClauses(m *MoveRules) [][]int {
+	var clauses [][]int
+	for r := range int8(9) {
+		for c := range int8(9) {
+			for n := range int8(9) {
+				for _, rc := range m.peers[r][c] {
+					clauses = append(clauses, []int{-SudokuVar(r, c, n), -SudokuVar(rc.Row, rc.Col, n)})
+				}
+				if m.neighbors == nil || n == 8 {
+					continue
+				}
+				for _, rc := range m.neighbors[r][c] {
+					clauses = append(clauses, []int{-SudokuVar(r, c, n), -SudokuVar(rc.Row, rc.Col, n+1)})
+				}
+			}
+		}
+	}
+	return clauses
+}
+
+// movePuzzle 返回满足规则的一个终局清空前三行后的谜题
+func movePuzzle(names []string) *[9][9]int8 {
+	var puzzle [9][9]int8
+	moves, err := NewMoveRules(names)
+	check(err)
+	(&PropagationSolver{Moves: moves}).Solve(&EmptySituation.cells, func(solution *[9][9]int8) bool {
+		puzzle = *solution
+		return false
+	})
+	for i := range 27 {
+		puzzle[i/9][i%9] = -1
+	}
+	return &puzzle
+}
+
+func TestMoveRules(t *testing.T) {
+	for _, names := range [][]string{
+		{"anti-knight"},
+		{"anti-king"},
+		{"non-consecutive"},
+		{"anti-knight", "non-consecutive"},
+	} {
+		moves, err := NewMoveRules(names)
+		check(err)
+		puzzle := movePuzzle(names)
+		sat := NewSATSolver()
+		sat.ExtraClauses = moveClauses(moves)
+		crossCheckSolvers(t, &PropagationSolver{Moves: moves}, sat, puzzle)
+		rules, err := NewVariantRules(&VariantPuzzle{Variants: names})
+		check(err)
+		crossCheckSolvers(t, &PropagationSolver{Variant: rules}, sat, puzzle)
+
+		//迭代搜索用撤销记录恢复局势，也要撤销规则的排除
+		s, trg := NewSituationFromCells(puzzle)
+		s.SetMoveRules(trg, moves)
+		ctx := &SudokuContext{Iterative: true}
+		count := ctx.Run(s, trg)
+		if count != len(solveAll(sat, puzzle)) {
+			t.Fatalf("%v：迭代搜索找到 %d 个解", names, count)
+		}
+		t.Logf("%v：%d 个解", names, count)
+	}
+	if _, err := NewMoveRules([]string{"anti-queen"}); err == nil {
+		t.Fatalf("应该返回错误")
+	}
+}
+
+func TestMoveRulesExclude(t *testing.T) {
+	moves, err := NewMoveRules([]string{"anti-knight", "non-consecutive"})
+	check(err)
+	s, trg := ParseSituation("")
+	s.SetMoveRules(trg, moves)
+	s.Set(trg, RCN(4, 4, 4))
+	//马步
+	for _, rc := range []RowCol{{2, 3}, {6, 5}, {3, 6}, {5, 2}} {
+		if s.cellExclude[4][rc.Row][rc.Col] != 1 {
+			t.Fatalf("(%d,%d) 应该排除 5", rc.Row+1, rc.Col+1)
+		}
+	}
+	//上下左右相邻的单元格排除 4、6，斜向相邻的单元格不排除
+	if s.numExcludeMask[3][4]&(1<<3|1<<5) != 1<<3|1<<5 || s.numExcludeMask[3][3]&(1<<3|1<<5) != 0 {
+		t.Fatalf("非连续排除错误：%09b %09b", s.numExcludeMask[3][4], s.numExcludeMask[3][3])
+	}
+
+	//已知数违反规则时发生矛盾
+	cells := EmptySituation.cells
+	cells[0][0], cells[1][2] = 0, 0
+	s, trg = NewSituationFromCells(&cells)
+	s.SetMoveRules(trg, moves)
+	if len(trg.Conflicts) == 0 {
+		t.Fatalf("相隔马步的 1 应该矛盾")
+	}
+}
+
+func TestMoveRulePuzzleFiles(t *testing.T) {
+	for _, name := range []string{"anti-knight", "non-consecutive"} {
+		filename := "puzzles/" + name + "-01.txt"
+		raw, err := os.ReadFile(filename)
+		check(err)
+		moves, err := NewMoveRules([]string{name})
+		check(err)
+		puzzle, err := ParseCellsFromLine(readPuzzleLines(bytes.NewReader(raw))[0])
+		check(err)
+		sat := NewSATSolver()
+		sat.ExtraClauses = moveClauses(moves)
+		if count := len(solveAll(sat, puzzle)); count != 1 {
+			t.Fatalf("%s 应该有唯一解，找到 %d 个", filename, count)
+		}
+		crossCheckSolvers(t, &PropagationSolver{Moves: moves}, sat, puzzle)
+
+		//变体谜题文件用 variant 指令启用同样的规则
+		vp, err := ParseVariantPuzzle("variant " + name + "\n" + string(raw))
+		check(err)
+		if count, err := vp.Run(NewSudokuContext(), func(g *Grid) bool { return true }); err != nil || count != 1 {
+			t.Fatalf("%s：变体谜题找到 %d 个解，%v", filename, count, err)
+		}
+	}
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// OutsideClue 是写在盘面外的线索：三明治（sandwich）、摩天楼（skyscraper）或者小杀手（little killer）
+type OutsideClue struct {
+	//线索的种类，见 outsideKinds
+	Kind string
+	//线索的位置，行或列为 -1、Rows（Cols）时在盘面外，例如 (-1,4) 在第5列的上方
+	Row, Col int
+	//从线索看向盘面的方向，例如 (1,0) 向下；小杀手是斜向的
+	DRow, DCol int
+	Value      int
+
+	//线索看到的单元格，由近到远
+	cells []int
+}
+
+// outsideKind 是一种盘面外的线索的规则
+type outsideKind struct {
+	name string
+	//diagonal 为 true 时线索斜向看向盘面，需要写出方向
+	diagonal bool
+	//maxValue 返回 size 个单元格时线索可以取的最大值
+	maxValue  func(size int) int
+	propagate func(g Board, cells []int, value int) bool
+}
+
+// outsideKinds 是所有盘面外的线索，种类名同时是谜题文件中的指令
+var outsideKinds = map[string]outsideKind{
+	"sandwich":      {"三明治", false, func(int) int { return 35 }, propagateSandwich},
+	"skyscraper":    {"摩天楼", false, func(size int) int { return size }, propagateSkyscraper},
+	"little-killer": {"小杀手", true, func(size int) int { return size * 9 }, propagateLittleKiller},
+}
+
+// diagonalDirections 是小杀手线索的方向
+var diagonalDirections = map[string][2]int{
+	"ne": {-1, 1},
+	"nw": {-1, -1},
+	"se": {1, 1},
+	"sw": {1, -1},
+}
+
+func init() {
+	for kind := range outsideKinds {
+		variantDirectives[kind] = func(p *variantParser, args []string) error {
+			clue, err := parseOutsideClue(p.shape, kind, args)
+			if err != nil {
+				return fmt.Errorf("%s: %w", kind, err)
+			}
+			p.vp.Outside = append(p.vp.Outside, clue)
+			return nil
+		}
+	}
+}
+
+// OutsideNames 返回所有盘面外的线索的种类
+func OutsideNames() []string {
+	var names []string
+	for name := range outsideKinds {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// parseOutsideClue 解析 "<位置> [方向] <值>"，位置是盘面外的单元格，例如 r0c5（第5列上方）、r3c10（第3行右侧），
+// 方向只有小杀手需要：ne、nw、se、sw
+func parseOutsideClue(l *Layout, kind string, args []string) (OutsideClue, error) {
+	clue := OutsideClue{Kind: kind}
+	k := outsideKinds[kind]
+	want := 2
+	if k.diagonal {
+		want = 3
+	}
+	if len(args) != want {
+		return clue, fmt.Errorf("expect %d arguments, got %d", want, len(args))
+	}
+	var r, c int
+	var rest string
+	if n, _ := fmt.Sscanf(strings.ToLower(args[0]), "r%dc%d%s", &r, &c, &rest); n != 2 ||
+		r < 0 || r > l.Rows+1 || c < 0 || c > l.Cols+1 {
+		return clue, fmt.Errorf("invalid position %q", args[0])
+	}
+	clue.Row, clue.Col = r-1, c-1
+	outRow, outCol := clue.Row < 0 || clue.Row >= l.Rows, clue.Col < 0 || clue.Col >= l.Cols
+	if !outRow && !outCol {
+		return clue, fmt.Errorf("position %s is inside the grid", args[0])
+	}
+	if k.diagonal {
+		dir, ok := diagonalDirections[args[1]]
+		if !ok {
+			return clue, fmt.Errorf("invalid direction %q, expect ne, nw, se or sw", args[1])
+		}
+		clue.DRow, clue.DCol = dir[0], dir[1]
+	} else {
+		switch {
+		case outRow && outCol:
+			return clue, fmt.Errorf("position %s is a corner", args[0])
+		case clue.Row < 0:
+			clue.DRow = 1
+		case clue.Row >= l.Rows:
+			clue.DRow = -1
+		case clue.Col < 0:
+			clue.DCol = 1
+		default:
+			clue.DCol = -1
+		}
+	}
+	size := len(clue.walk(l))
+	if size == 0 {
+		return clue, fmt.Errorf("clue at %s does not point into the grid", args[0])
+	}
+	value, err := strconv.Atoi(args[len(args)-1])
+	if err != nil || value < 0 || value > k.maxValue(size) {
+		return clue, fmt.Errorf("invalid value %q", args[len(args)-1])
+	}
+	clue.Value = value
+	return clue, nil
+}
+
+// walk 返回从线索沿着方向看到的单元格
+func (x *OutsideClue) walk(l *Layout) []int {
+	var cells []int
+	r, c := x.Row+x.DRow, x.Col+x.DCol
+	for r >= 0 && r < l.Rows && c >= 0 && c < l.Cols {
+		cells = append(cells, l.Index(r, c))
+		r, c = r+x.DRow, c+x.DCol
+	}
+	return cells
+}
+
+func (x *OutsideClue) Propagate(g Board) bool {
+	return outsideKinds[x.Kind].propagate(g, x.cells, x.Value)
+}
+
+func (x *OutsideClue) Directive(l *Layout) string {
+	dir := ""
+	for name, d := range diagonalDirections {
+		if outsideKinds[x.Kind].diagonal && d == [2]int{x.DRow, x.DCol} {
+			dir = " " + name
+		}
+	}
+	return fmt.Sprintf("%s r%dc%d%s %d", x.Kind, x.Row+1, x.Col+1, dir, x.Value)
+}
+
+// label 返回显示在盘面外的文字，小杀手加上方向
+func (x *OutsideClue) label() string {
+	s := strconv.Itoa(x.Value)
+	if outsideKinds[x.Kind].diagonal {
+		if x.DRow == x.DCol {
+			s += `\`
+		} else {
+			s += "/"
+		}
+	}
+	return s
+}
+
+// propagateSandwich 三明治：一行（列）中 1 和 9 之间的数字之和为 value。
+// 枚举 1 和 9 的位置，以及它们之间的数字组合，只保留至少在一种可行的情况中出现的候选数。
+func propagateSandwich(g Board, cells []int, value int) bool {
+	const one, nine = 1 << 0, 1 << 8
+	var allowed [9]int16
+	found := false
+	for p1 := range cells {
+		if g.Candidates(cells[p1])&one == 0 {
+			continue
+		}
+		for p9 := range cells {
+			if p9 == p1 || g.Candidates(cells[p9])&nine == 0 {
+				continue
+			}
+			lo, hi := min(p1, p9)+1, max(p1, p9)
+			between := cells[lo:hi]
+			//1 和 9 之外的单元格不能是 1 或 9
+			fits := true
+			for k, i := range cells {
+				if k != p1 && k != p9 && (k < lo || k >= hi) && g.Candidates(i)&^(one|nine) == 0 {
+					fits = false
+					break
+				}
+			}
+			if !fits || value > 0 && len(between) == 0 || len(between) > 7 {
+				continue
+			}
+			//中间的数字组合
+			var middle [9]int16
+			middleFound := len(between) == 0 && value == 0
+			if len(between) > 0 && value <= 45 {
+				for _, combo := range cageCombos[len(between)][value] {
+					if combo&(one|nine) != 0 {
+						continue
+					}
+					var union int16
+					ok := true
+					for _, i := range between {
+						m := g.Candidates(i) & combo
+						if m == 0 {
+							ok = false
+							break
+						}
+						union |= m
+					}
+					if !ok || union != combo {
+						continue
+					}
+					middleFound = true
+					for k, i := range between {
+						middle[lo+k] |= g.Candidates(i) & combo
+					}
+				}
+			}
+			if !middleFound {
+				continue
+			}
+			found = true
+			for k, i := range cells {
+				switch {
+				case k == p1:
+					allowed[k] |= one
+				case k == p9:
+					allowed[k] |= nine
+				case k >= lo && k < hi:
+					allowed[k] |= middle[k]
+				default:
+					allowed[k] |= g.Candidates(i) &^ (one | nine)
+				}
+			}
+		}
+	}
+	if !found {
+		g.fail("三明治 %s 的和不可能为 %d", formatCells(g.Layout(), cells), value)
+		return true
+	}
+	changed := false
+	for k, i := range cells {
+		for n := range int8(9) {
+			if allowed[k]&(1<<n) == 0 && g.Exclude(i, n) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// propagateSkyscraper 摩天楼：数字代表楼的高度，从线索能看到 value 栋楼（比前面所有的楼都高的楼）。
+// 按（最高的楼，看到的楼数）的状态从两端递推，只保留能达到 value 的候选数；除了整行（列）一定有 9 以外，
+// 不考虑数字互不相同，由房保证。
+func propagateSkyscraper(g Board, cells []int, value int) bool {
+	//forward[k][m][v]：前 k 个单元格最高为 m、看到 v 栋楼是否可能
+	var forward [10][10][10]bool
+	//backward[k][m][v]：在前 k 个单元格最高为 m、看到 v 栋楼的状态下，其余单元格是否可以使看到的楼数为 value
+	var backward [10][10][10]bool
+	size := len(cells)
+	forward[0][0][0] = true
+	for k, i := range cells {
+		for m := range 10 {
+			for v := range size {
+				if !forward[k][m][v] {
+					continue
+				}
+				for n := range 9 {
+					if g.Candidates(i)&(1<<n) == 0 {
+						continue
+					}
+					if h := n + 1; h > m {
+						forward[k+1][h][v+1] = true
+					} else {
+						forward[k+1][m][v] = true
+					}
+				}
+			}
+		}
+	}
+	//整行（列）一定有 9，最高的楼是 9
+	for m := range 10 {
+		backward[size][m][value] = size < 9 || m == 9
+	}
+	var allowed [9]int16
+	for k := size - 1; k >= 0; k-- {
+		i := cells[k]
+		for m := range 10 {
+			for v := range size {
+				for n := range 9 {
+					if g.Candidates(i)&(1<<n) == 0 {
+						continue
+					}
+					m2, v2 := m, v
+					if h := n + 1; h > m {
+						m2, v2 = h, v+1
+					}
+					if !backward[k+1][m2][v2] {
+						continue
+					}
+					backward[k][m][v] = true
+					if forward[k][m][v] {
+						allowed[k] |= 1 << n
+					}
+				}
+			}
+		}
+	}
+	changed := false
+	for k, i := range cells {
+		for n := range int8(9) {
+			if allowed[k]&(1<<n) == 0 && g.Exclude(i, n) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// propagateLittleKiller 小杀手：斜线上的数字之和为 value，数字可以重复（同一宫内的由房保证不同），按上下界排除
+func propagateLittleKiller(g Board, cells []int, value int) bool {
+	return propagateSum(g, cells, value, false, "小杀手")
+}
+
+// outsideRules 为线索计算看到的单元格，加入显示的文字，返回约束
+func outsideRules(l *Layout, clues []OutsideClue) []Constraint {
+	var rules []Constraint
+	l.outsideLabels = make(map[[2]int]string)
+	for k := range clues {
+		x := &clues[k]
+		x.cells = x.walk(l)
+		key := [2]int{x.Row, x.Col}
+		if label, ok := l.outsideLabels[key]; ok {
+			l.outsideLabels[key] = label + "," + x.label()
+		} else {
+			l.outsideLabels[key] = x.label()
+		}
+		rules = append(rules, x)
+	}
+	return rules
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPropagateOutside(t *testing.T) {
+	cases := []struct {
+		directive string
+		givens    map[int]int8
+		cell      int
+		want      []int
+	}{
+		//和为 0：1 和 9 相邻
+		{"sandwich r1c0 0", map[int]int8{0: 1}, 1, []int{9}},
+		//和为 35：2~8 都在 1 和 9 之间，1 和 9 在两端
+		{"sandwich r0c1 35", nil, 0, []int{1, 9}},
+		{"sandwich r0c1 35", nil, 36, []int{2, 3, 4, 5, 6, 7, 8}},
+		{"skyscraper r1c10 1", nil, 8, []int{9}},
+		{"skyscraper r10c1 9", nil, 72, []int{1}},
+		{"skyscraper r10c1 9", nil, 63, []int{2}},
+		{"skyscraper r0c3 2", nil, 2, []int{1, 2, 3, 4, 5, 6, 7, 8}},
+		//第一栋楼是 1 时，第二栋必须是 9
+		{"skyscraper r0c3 2", map[int]int8{2: 1}, 11, []int{9}},
+		{"little-killer r0c7 se 3", nil, 7, []int{1, 2}},
+		{"little-killer r0c7 se 17", nil, 17, []int{8, 9}},
+	}
+	for _, tc := range cases {
+		vp, err := ParseVariantPuzzle(tc.directive + "\n" + strings.Repeat(".........\n", 9))
+		check(err)
+		g := NewGrid(vp.Layout())
+		for i, n := range tc.givens {
+			g.Set(i, n-1)
+		}
+		for applyConstraints(g, vp) && g.Conflict() == "" {
+		}
+		if g.Conflict() != "" {
+			t.Fatalf("%s：%s", tc.directive, g.Conflict())
+		}
+		if got := digits(g.Candidates(tc.cell)); !slices.Equal(got, tc.want) {
+			t.Fatalf("%s：%s 的候选数为 %v，应该是 %v", tc.directive, vp.Layout().CellName(tc.cell), got, tc.want)
+		}
+	}
+}
+
+func TestOutsidePuzzleFiles(t *testing.T) {
+	for _, name := range OutsideNames() {
+		filename := "puzzles/" + name + "-01.txt"
+		raw, err := os.ReadFile(filename)
+		check(err)
+		vp, err := ParseVariantPuzzle(string(raw))
+		check(err)
+		if len(vp.Outside) == 0 {
+			t.Fatalf("%s 没有盘面外的线索", filename)
+		}
+		count, err := vp.Run(NewSudokuContext(), func(g *Grid) bool {
+			for _, x := range vp.Outside {
+				if x.Propagate(g) || g.Conflict() != "" {
+					t.Fatalf("%s：%s 不成立", filename, x.Directive(g.Layout()))
+				}
+			}
+			return true
+		})
+		check(err)
+		if count != 1 {
+			t.Fatalf("%s 应该有唯一解，找到 %d 个", filename, count)
+		}
+
+		parsed, err := ParseVariantPuzzle(vp.String())
+		check(err)
+		if len(parsed.Outside) != len(vp.Outside) {
+			t.Fatalf("%s：导出后重新解析不一致", filename)
+		}
+		for k := range vp.Outside {
+			a, b := parsed.Outside[k], vp.Outside[k]
+			if a.Kind != b.Kind || a.Row != b.Row || a.Col != b.Col || a.DRow != b.DRow || a.DCol != b.DCol || a.Value != b.Value {
+				t.Fatalf("%s：第 %d 个线索不一致", filename, k+1)
+			}
+		}
+	}
+}
+
+func TestParseOutsideClue(t *testing.T) {
+	for _, bad := range []string{
+		"sandwich r1c1 5\n" + multiSolutionPuzzle,
+		"sandwich r0c0 5\n" + multiSolutionPuzzle,
+		"sandwich r0c1 36\n" + multiSolutionPuzzle,
+		"skyscraper r0c1 10\n" + multiSolutionPuzzle,
+		"skyscraper r0c12 1\n" + multiSolutionPuzzle,
+		"little-killer r0c1 20\n" + multiSolutionPuzzle,
+		"little-killer r0c1 up 20\n" + multiSolutionPuzzle,
+		"little-killer r0c1 nw 20\n" + multiSolutionPuzzle,
+	} {
+		if _, err := ParseVariantPuzzle(bad); err == nil {
+			t.Fatalf("应该返回错误：%q", bad)
+		}
+	}
+}
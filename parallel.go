@@ -0,0 +1,227 @@
+package main
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+)
+
+// parallelTask 是一个还没有演算的分支
+type parallelTask struct {
+	s *Situation
+	t *Trigger
+}
+
+// parallelWorker 是单个谜题内并行搜索的一个线程。
+// 每个线程有自己的双端队列：自己从尾部取最新的分支（深度优先），
+// 空闲的线程从其他线程队列的头部窃取最早的分支，这些分支通常离根最近、剩余的搜索量最大。
+type parallelWorker struct {
+	ctx   *SudokuContext
+	mtx   sync.Mutex
+	tasks []parallelTask
+}
+
+func (w *parallelWorker) push(task parallelTask) {
+	w.mtx.Lock()
+	w.tasks = append(w.tasks, task)
+	w.mtx.Unlock()
+}
+
+func (w *parallelWorker) popBottom() (parallelTask, bool) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if len(w.tasks) == 0 {
+		return parallelTask{}, false
+	}
+	task := w.tasks[len(w.tasks)-1]
+	w.tasks = w.tasks[:len(w.tasks)-1]
+	return task, true
+}
+
+// parallelQueue 统计所有线程的队列，空闲的线程在 cond 上等待新的分支，而不是反复轮询
+type parallelQueue struct {
+	mtx  sync.Mutex
+	cond *sync.Cond
+	//队列中还没有被取走的分支数
+	queued int
+	//已经入队但还没有演算完成的分支数，为 0 时搜索结束
+	pending int
+}
+
+func newParallelQueue() *parallelQueue {
+	q := &parallelQueue{}
+	q.cond = sync.NewCond(&q.mtx)
+	return q
+}
+
+// push 把分支放入线程 w 的队列，唤醒一个等待的线程
+func (q *parallelQueue) push(w *parallelWorker, task parallelTask) {
+	w.push(task)
+	q.mtx.Lock()
+	q.queued++
+	q.pending++
+	q.mtx.Unlock()
+	q.cond.Signal()
+}
+
+// take 记录从某个队列取走了一个分支
+func (q *parallelQueue) take() {
+	q.mtx.Lock()
+	q.queued--
+	q.mtx.Unlock()
+}
+
+// done 记录一个分支演算完成，全部完成时唤醒所有等待的线程
+func (q *parallelQueue) done() {
+	q.mtx.Lock()
+	q.pending--
+	if q.pending == 0 {
+		q.cond.Broadcast()
+	}
+	q.mtx.Unlock()
+}
+
+// wait 等待有分支入队，返回 false 表示所有分支都已演算完成
+func (q *parallelQueue) wait() bool {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	for q.queued == 0 && q.pending > 0 {
+		q.cond.Wait()
+	}
+	return q.pending > 0
+}
+
+func (w *parallelWorker) stealTop() (parallelTask, bool) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if len(w.tasks) == 0 {
+		return parallelTask{}, false
+	}
+	task := w.tasks[0]
+	w.tasks[0] = parallelTask{}
+	w.tasks = w.tasks[1:]
+	return task, true
+}
+
+// parallelEval 使用 ctx.Parallel 个线程搜索同一个谜题，结果与 recurseEval 相同（解的顺序可能不同）。
+// 各线程的 evalCount、branchCount、ruleStats 等统计最后汇总到 ctx。
+func (ctx *SudokuContext) parallelEval(s *Situation, t *Trigger) int {
+	var (
+		solutionMtx sync.Mutex
+		count       atomic.Int64
+		stopped     atomic.Bool
+		queue       = newParallelQueue()
+	)
+
+	workers := make([]*parallelWorker, ctx.Parallel)
+	for i := range workers {
+		wctx := &SudokuContext{
+			StopAtFirstSolution: ctx.StopAtFirstSolution,
+			GensApplyRules:      ctx.GensApplyRules,
+			AdaptiveRules:       ctx.AdaptiveRules,
+			MinRuleYield:        ctx.MinRuleYield,
+			Strategy:            ctx.Strategy,
+		}
+		if ctx.Rand != nil {
+			wctx.Rand = rand.New(rand.NewSource(ctx.Rand.Int63()))
+		}
+		wctx.OnSolution = func(solution *[9][9]int8) bool {
+			solutionMtx.Lock()
+			defer solutionMtx.Unlock()
+			if stopped.Load() {
+				return false
+			}
+			count.Add(1)
+			if ctx.OnSolution != nil {
+				if !ctx.OnSolution(solution) {
+					stopped.Store(true)
+				}
+			} else {
+				cells := *solution
+				ctx.solutions = append(ctx.solutions, &cells)
+			}
+			if ctx.StopAtFirstSolution {
+				stopped.Store(true)
+			}
+			return !stopped.Load()
+		}
+		workers[i] = &parallelWorker{ctx: wctx}
+	}
+
+	queue.push(workers[0], parallelTask{DuplicateSituation(s), DuplicateTrigger(t)})
+
+	var wg sync.WaitGroup
+	for i, w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				task, ok := w.popBottom()
+				for j := 1; !ok && j < len(workers); j++ {
+					task, ok = workers[(i+j)%len(workers)].stealTop()
+				}
+				if !ok {
+					if !queue.wait() {
+						return
+					}
+					continue
+				}
+				queue.take()
+				if !stopped.Load() {
+					w.expand(task, queue)
+				}
+				ReleaseSituation(task.s)
+				ReleaseTrigger(task.t)
+				queue.done()
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, w := range workers {
+		ctx.evalCount += w.ctx.evalCount
+		ctx.rulesDebranch += w.ctx.rulesDebranch
+		for i, branches := range w.ctx.branchCount {
+			ctx.branchCount[i] += branches
+		}
+		for i := range ctx.ruleStats {
+			ctx.ruleStats[i].add(&w.ctx.ruleStats[i])
+		}
+	}
+	ctx.stopped = stopped.Load()
+	return int(count.Load())
+}
+
+// expand 演算一个分支，找到解则提交，需要继续分支则把所有没有矛盾的子分支放入自己的队列
+func (w *parallelWorker) expand(task parallelTask, queue *parallelQueue) {
+	ctx := w.ctx
+	s, t := task.s, task.t
+	if !ctx.branchEval(s, t) {
+		return
+	}
+	if s.Completed() {
+		ctx.addSolution(s)
+		return
+	}
+	candidates := ctx.chooseBranch(s)
+	ctx.branchCount[candidates.Size()]++
+	if candidates.Size() == 0 {
+		return
+	}
+	ctx.shuffle(candidates)
+	//倒序入队，使第一个候选项最先从队尾取出
+	for i := len(candidates.Choices) - 1; i >= 0; i-- {
+		s2 := DuplicateSituation(s)
+		t2 := DuplicateTrigger(t)
+		s2.branchGeneration++
+		s2.Set(t2, candidates.Choices[i])
+		ctx.evalCount++
+		if len(t2.Conflicts) > 0 {
+			ReleaseSituation(s2)
+			ReleaseTrigger(t2)
+			continue
+		}
+		queue.push(w, parallelTask{s2, t2})
+	}
+	ReleaseBranchChoices(candidates)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParallelEval(t *testing.T) {
+	raw, err := os.ReadFile("puzzles/hard-02.txt")
+	check(err)
+	multi := ".........\n" + string(raw[10:])
+
+	s, trg := ParseSituation(multi)
+	sequential := NewSudokuContext()
+	expected := sequential.Run(DuplicateSituation(s), DuplicateTrigger(trg))
+
+	parallel := &SudokuContext{Parallel: 4}
+	if count := parallel.Run(DuplicateSituation(s), DuplicateTrigger(trg)); count != expected || len(parallel.solutions) != expected {
+		t.Fatalf("并行搜索解的数量 %d != %d", count, expected)
+	}
+	seen := make(map[[9][9]int8]bool)
+	for _, solution := range sequential.solutions {
+		seen[*solution] = true
+	}
+	for _, solution := range parallel.solutions {
+		if !seen[*solution] {
+			t.Fatalf("并行搜索得到了不同的解：%s", FormatCellsLine(solution))
+		}
+		delete(seen, *solution)
+	}
+	if parallel.evalCount != sequential.evalCount || parallel.branchCount != sequential.branchCount {
+		t.Fatalf("并行搜索的统计不一致：%d %v != %d %v",
+			parallel.evalCount, parallel.branchCount, sequential.evalCount, sequential.branchCount)
+	}
+
+	first := &SudokuContext{Parallel: 4, StopAtFirstSolution: true}
+	if count := first.Run(DuplicateSituation(s), DuplicateTrigger(trg)); count != 1 || len(first.solutions) != 1 {
+		t.Fatalf("找到一个解即停止，实际找到 %d 个", count)
+	}
+
+	calls := 0
+	limited := &SudokuContext{Parallel: 4}
+	limited.OnSolution = func(solution *[9][9]int8) bool {
+		calls++
+		return calls < 10
+	}
+	if count := limited.Run(DuplicateSituation(s), DuplicateTrigger(trg)); count != 10 || calls != 10 {
+		t.Fatalf("OnSolution 返回 false 后应该停止，找到 %d 个解", count)
+	}
+}
+
+func TestParallelEvalHardest(t *testing.T) {
+	for _, line := range readPuzzleLines(openInput("assets/hardest_1106.txt"))[:20] {
+		s, trg := ParseSituationFromLine(line)
+		sequential := NewSudokuContext()
+		sequential.Run(DuplicateSituation(s), DuplicateTrigger(trg))
+		parallel := &SudokuContext{Parallel: 3}
+		parallel.Run(s, trg)
+		if len(parallel.solutions) != 1 || *parallel.solutions[0] != *sequential.solutions[0] {
+			t.Fatalf("并行搜索结果不一致：%s", line)
+		}
+		if parallel.evalCount != sequential.evalCount || parallel.branchCount != sequential.branchCount {
+			t.Fatalf("并行搜索的统计不一致：%s", line)
+		}
+	}
+}
+
+func TestParallelValidate(t *testing.T) {
+	for _, ctx := range []*SudokuContext{
+		{Parallel: 4, Cache: NewTranspositionCache(16)},
+		{Parallel: 4, ShowProcess: true},
+		{Parallel: 4, ShowBranch: true},
+	} {
+		if ctx.Validate() == nil {
+			t.Fatalf("多线程搜索不支持的选项没有报错：%+v", ctx)
+		}
+	}
+	if err := (&SudokuContext{Parallel: 4, StopAtFirstSolution: true}).Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Relation 是上下或左右相邻的两个单元格之间的标记：Kropki 的白点、黑点，XV 的 X、V，或者大于号
+type Relation struct {
+	//标记的种类，见 relationKinds
+	Kind string
+	//相邻的两个单元格，大于号表示 A 的数大于 B 的数
+	A, B int
+}
+
+// relationKind 是一种标记的规则
+type relationKind struct {
+	//谜题文件中的指令，例如 "kropki white"
+	directive string
+	name      string
+	//否定约束的分组：启用分组的否定约束后，没有这一组标记的相邻单元格不能满足组内任何一种标记的关系
+	group string
+	//holds 返回数字 x、y（1~9）是否满足标记的关系
+	holds func(x, y int) bool
+}
+
+// relationKinds 是所有的标记种类
+var relationKinds = map[string]relationKind{
+	"white": {"kropki white", "白点", "kropki", func(x, y int) bool { return x-y == 1 || y-x == 1 }},
+	"black": {"kropki black", "黑点", "kropki", func(x, y int) bool { return x == 2*y || y == 2*x }},
+	"x":     {"xv x", "X", "xv", func(x, y int) bool { return x+y == 10 }},
+	"v":     {"xv v", "V", "xv", func(x, y int) bool { return x+y == 5 }},
+	"gt":    {"gt", "大于号", "", func(x, y int) bool { return x > y }},
+}
+
+// NegativeGroups 返回 negative 指令可用的否定约束分组
+func NegativeGroups() []string {
+	seen := make(map[string]bool)
+	var groups []string
+	for _, kind := range relationKinds {
+		if kind.group != "" && !seen[kind.group] {
+			seen[kind.group] = true
+			groups = append(groups, kind.group)
+		}
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+func (x *Relation) Directive(l *Layout) string {
+	return fmt.Sprintf("%s %s", relationKinds[x.Kind].directive, formatCells(l, []int{x.A, x.B}))
+}
+
+// mark 返回标记在盘面上显示的字符，vertical 为 true 时 A、B 上下相邻
+func (x *Relation) mark(vertical bool) string {
+	switch x.Kind {
+	case "white":
+		return "o"
+	case "black":
+		return "*"
+	case "x":
+		return "X"
+	case "v":
+		return "V"
+	}
+	//大于号的开口朝向较大的数
+	switch {
+	case vertical && x.A < x.B:
+		return "v"
+	case vertical:
+		return "^"
+	case x.A < x.B:
+		return ">"
+	}
+	return "<"
+}
+
+// adjacent 返回两个单元格是否上下或左右相邻
+func adjacent(l *Layout, a, b int) bool {
+	ra, ca := l.RowCol(a)
+	rb, cb := l.RowCol(b)
+	return ra == rb && (ca-cb == 1 || cb-ca == 1) || ca == cb && (ra-rb == 1 || rb-ra == 1)
+}
+
+// pairRule 要求单元格 a、b 的数满足关系，由标记或者否定约束生成
+type pairRule struct {
+	name  string
+	a, b  int
+	table *pairTable
+}
+
+func newPairRule(name string, a, b int, holds func(x, y int) bool) *pairRule {
+	return &pairRule{name: name, a: a, b: b, table: newPairTable(holds)}
+}
+
+func (x *pairRule) Propagate(g Board) bool {
+	return x.table.propagate(g, x.a, x.b)
+}
+
+func (x *pairRule) Directive(l *Layout) string {
+	return fmt.Sprintf("# %s：%s", x.name, formatCells(l, []int{x.a, x.b}))
+}
+
+// pairTable 是两个单元格之间的关系的查找表
+type pairTable struct {
+	//support[x] 是 a 填 x 时 b 可以填的数的掩码，reverse[y] 是 b 填 y 时 a 可以填的数的掩码
+	support, reverse [9]int16
+}
+
+func newPairTable(holds func(x, y int) bool) *pairTable {
+	t := &pairTable{}
+	for x := range 9 {
+		for y := range 9 {
+			if holds(x+1, y+1) {
+				t.support[x] |= 1 << y
+				t.reverse[y] |= 1 << x
+			}
+		}
+	}
+	return t
+}
+
+// propagate 排除在另一个单元格中找不到相容的数的候选数，返回是否有新的排除
+func (t *pairTable) propagate(g Board, a, b int) bool {
+	changed := false
+	for n := range int8(9) {
+		if g.Candidates(a)&(1<<n) != 0 && g.Candidates(b)&t.support[n] == 0 && g.Exclude(a, n) {
+			changed = true
+		}
+	}
+	for n := range int8(9) {
+		if g.Candidates(b)&(1<<n) != 0 && g.Candidates(a)&t.reverse[n] == 0 && g.Exclude(b, n) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+// relationRules 为标记生成约束；对 negative 中的每个分组，没有这一组标记的相邻单元格生成否定约束
+func relationRules(l *Layout, relations []Relation, negative []string) []Constraint {
+	var rules []Constraint
+	//marked[{a,b}] 是相邻单元格 a<b 之间的标记所属的分组
+	marked := make(map[[2]int]map[string]bool)
+	for _, x := range relations {
+		kind := relationKinds[x.Kind]
+		rules = append(rules, newPairRule(kind.name, x.A, x.B, kind.holds))
+		key := [2]int{min(x.A, x.B), max(x.A, x.B)}
+		if marked[key] == nil {
+			marked[key] = make(map[string]bool)
+		}
+		marked[key][kind.group] = true
+	}
+	for _, group := range negative {
+		var kinds []relationKind
+		for _, kind := range relationKinds {
+			if kind.group == group {
+				kinds = append(kinds, kind)
+			}
+		}
+		table := newPairTable(func(x, y int) bool {
+			for _, kind := range kinds {
+				if kind.holds(x, y) {
+					return false
+				}
+			}
+			return true
+		})
+		for a := range l.Size() {
+			r, c := l.RowCol(a)
+			for _, b := range []int{l.Index(r, c+1), l.Index(r+1, c)} {
+				if b >= l.Size() || !adjacent(l, a, b) || !l.Present(a) || !l.Present(b) || marked[[2]int{a, b}][group] {
+					continue
+				}
+				rules = append(rules, &pairRule{name: group + "否定约束", a: a, b: b, table: table})
+			}
+		}
+	}
+	return rules
+}
+
+// parseRelations 解析 kind 标记的单元格对，例如 r1c1 r1c2 r5c5 r6c5
+func parseRelations(l *Layout, kind string, tokens []string) ([]Relation, error) {
+	if len(tokens) == 0 || len(tokens)%2 != 0 {
+		return nil, fmt.Errorf("expect pairs of cells")
+	}
+	var relations []Relation
+	for k := 0; k < len(tokens); k += 2 {
+		cells, err := parseCells(l, tokens[k:k+2])
+		if err != nil {
+			return nil, err
+		}
+		if !adjacent(l, cells[0], cells[1]) {
+			return nil, fmt.Errorf("cells %s and %s are not adjacent", tokens[k], tokens[k+1])
+		}
+		relations = append(relations, Relation{Kind: kind, A: cells[0], B: cells[1]})
+	}
+	return relations, nil
+}
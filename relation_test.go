@@ -0,0 +1,109 @@
+package main
+
+import (
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestPairRule(t *testing.T) {
+	l := NewLayout(9, 9, StandardHouses())
+	cases := []struct {
+		kind string
+		//a 只能填 given 时，b 剩下的候选数（1~9）
+		given int8
+		want  []int
+	}{
+		{"white", 5, []int{4, 6}},
+		{"white", 1, []int{2}},
+		{"black", 4, []int{2, 8}},
+		{"black", 7, nil},
+		{"x", 3, []int{7}},
+		{"v", 5, nil},
+		{"gt", 3, []int{1, 2}},
+	}
+	for _, tc := range cases {
+		g := NewGrid(l)
+		for n := range int8(9) {
+			if n != tc.given-1 {
+				g.Exclude(0, n)
+			}
+		}
+		kind := relationKinds[tc.kind]
+		newPairRule(kind.name, 0, 1, kind.holds).Propagate(g)
+		var got []int
+		for n := range 9 {
+			if g.Candidates(1)&(1<<n) != 0 {
+				got = append(got, n+1)
+			}
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Fatalf("%s：(1,1) 为 %d 时 (1,2) 的候选数为 %v，应该是 %v", kind.name, tc.given, got, tc.want)
+		}
+	}
+
+	//否定约束：(1,1) 填 5，有白点的 (1,2) 只能是 4、6；没有标记的 (2,1) 不能是 4、6，(1,2) 填 4 后 (1,3) 不能是 2、3、5、8
+	vp := &VariantPuzzle{Relations: []Relation{{Kind: "white", A: 0, B: 1}}, Negative: []string{"kropki"}}
+	g := NewGrid(vp.Layout())
+	g.Set(0, 4)
+	applyConstraints(g, vp)
+	if g.Candidates(1) != 1<<3|1<<5 || g.Candidates(9)&(1<<3|1<<5) != 0 {
+		t.Fatalf("否定约束排除错误：%09b %09b", g.Candidates(1), g.Candidates(9))
+	}
+	g.Set(1, 3)
+	applyConstraints(g, vp)
+	if g.Candidates(2)&(1<<1|1<<2|1<<4|1<<7) != 0 {
+		t.Fatalf("否定约束排除错误：%09b", g.Candidates(2))
+	}
+}
+
+func TestRelationPuzzleFiles(t *testing.T) {
+	//这几个例子是从同一个终盘生成标记得到的，不是出版的谜题
+	const solution = "598736124643192758712485963326971845951864372487523619164359287835217496279648531"
+	for _, filename := range []string{"puzzles/kropki-01.txt", "puzzles/xv-01.txt", "puzzles/gt-01.txt"} {
+		raw, err := os.ReadFile(filename)
+		check(err)
+		vp, err := ParseVariantPuzzle(string(raw))
+		check(err)
+		if len(vp.Relations) == 0 {
+			t.Fatalf("%s 没有标记", filename)
+		}
+		var cells [9][9]int8
+		count, err := vp.Run(NewSudokuContext(), func(g *Grid) bool {
+			g.ToCells(&cells)
+			if string(FormatCellsLine(&cells)) != solution {
+				t.Fatalf("%s 的解不正确：%s", filename, FormatCellsLine(&cells))
+			}
+			for _, x := range vp.Relations {
+				if !relationKinds[x.Kind].holds(int(g.Get(x.A))+1, int(g.Get(x.B))+1) {
+					t.Fatalf("%s：%s 不成立", filename, x.Directive(g.Layout()))
+				}
+			}
+			return true
+		})
+		check(err)
+		if count != 1 {
+			t.Fatalf("%s 应该有唯一解，找到 %d 个", filename, count)
+		}
+
+		parsed, err := ParseVariantPuzzle(vp.String())
+		check(err)
+		if !slices.Equal(parsed.Relations, vp.Relations) || !slices.Equal(parsed.Negative, vp.Negative) {
+			t.Fatalf("%s：导出后重新解析不一致", filename)
+		}
+	}
+}
+
+func TestParseRelation(t *testing.T) {
+	for _, bad := range []string{
+		"kropki white r1c1 r1c3\n" + multiSolutionPuzzle,
+		"kropki grey r1c1 r1c2\n" + multiSolutionPuzzle,
+		"xv x r1c1\n" + multiSolutionPuzzle,
+		"gt r1c9 r2c1\n" + multiSolutionPuzzle,
+		"negative gt\n" + multiSolutionPuzzle,
+	} {
+		if _, err := ParseVariantPuzzle(bad); err == nil {
+			t.Fatalf("应该返回错误：%q", bad)
+		}
+	}
+}
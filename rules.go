@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// ruleFamily 是一类复杂排除规则
+type ruleFamily struct {
+	name  string
+	apply func(s *Situation, t *Trigger, dirty ruleDirty) int
+}
+
+// ruleFamilyCount 是 ruleFamilies 的长度，Situation 用它声明每类规则的标记，不能直接用 len(ruleFamilies)
+const ruleFamilyCount = 9
+
+// ruleFamilies 是所有复杂排除规则，按 ApplyExcludeRules 的应用顺序排列
+var ruleFamilies = [ruleFamilyCount]ruleFamily{
+	{"X-Wing（行）", func(s *Situation, t *Trigger, d ruleDirty) int {
+		return s.applyDimVariantRule(t, d.nums, s.getMaskNumRow, s.getMaskNumCol, NRC)
+	}},
+	{"X-Wing（列）", func(s *Situation, t *Trigger, d ruleDirty) int {
+		return s.applyDimVariantRule(t, d.nums, s.getMaskNumCol, s.getMaskNumRow, NCR)
+	}},
+	{"显性数对（行）", func(s *Situation, t *Trigger, d ruleDirty) int {
+		return s.applyDimVariantRule(t, d.rows, s.getMaskRowCol, s.getMaskRowNum, RCN)
+	}},
+	{"隐性数对（行）", func(s *Situation, t *Trigger, d ruleDirty) int {
+		return s.applyDimVariantRule(t, d.rows, s.getMaskRowNum, s.getMaskRowCol, RNC)
+	}},
+	{"隐性数对（列）", func(s *Situation, t *Trigger, d ruleDirty) int {
+		return s.applyDimVariantRule(t, d.cols, s.getMaskColNum, s.getMaskColRow, CNR)
+	}},
+	{"显性数对（列）", func(s *Situation, t *Trigger, d ruleDirty) int {
+		return s.applyDimVariantRule(t, d.cols, s.getMaskColRow, s.getMaskColNum, CRN)
+	}},
+	{"隐性数对（宫）", func(s *Situation, t *Trigger, d ruleDirty) int {
+		return s.applyDimVariantRule(t, d.blocks, s.getMaskBlockNum, s.getMaskBlockPos, BNPtoRCN)
+	}},
+	{"显性数对（宫）", func(s *Situation, t *Trigger, d ruleDirty) int {
+		return s.applyDimVariantRule(t, d.blocks, s.getMaskBlockPos, s.getMaskBlockNum, BPNtoRCN)
+	}},
+	{"宫区排除", func(s *Situation, t *Trigger, d ruleDirty) int {
+		return s.applyBlockRules(t, d.nums)
+	}},
+}
+
+const (
+	//每类规则开始时至少应用的次数，之后才根据收益决定是否启用
+	ruleWarmup = 4
+	//最近收益和耗时的衰减系数
+	ruleDecay = 0.9
+	//关闭的规则每跳过这么多次，重新试用一次，以便局势变化后重新启用
+	ruleProbeInterval = 32
+	//MinRuleYield 为 0 时使用的默认值：每微秒新增排除数
+	defaultMinRuleYield = 1
+)
+
+// RuleStats 是一类复杂排除规则的统计，AdaptiveRules 为 true 时记录
+type RuleStats struct {
+	Name string
+	//应用次数（含试用）
+	Calls int
+	//因收益低被跳过的次数
+	Skipped int
+	//新增排除数
+	Excludes int
+	//应用的总耗时
+	Cost time.Duration
+	//在启用和关闭之间切换的次数
+	Toggles int
+	//最后的状态
+	Enabled bool
+
+	//最近的新增排除数和耗时（微秒），每次应用后乘以 ruleDecay，用于决定是否启用
+	recentExcludes, recentMicros float64
+	//关闭后连续跳过的次数
+	skipStreak int
+}
+
+func (st *RuleStats) String() string {
+	state := "关闭"
+	if st.Enabled {
+		state = "启用"
+	}
+	return fmt.Sprintf("%s  应用 %d  跳过 %d  排除 %d  耗时 %v  切换 %d  %s",
+		st.Name, st.Calls, st.Skipped, st.Excludes, st.Cost, st.Toggles, state)
+}
+
+// shouldApply 根据最近每微秒的新增排除数决定是否应用这类规则
+func (st *RuleStats) shouldApply(minYield float64) bool {
+	if st.Calls < ruleWarmup {
+		st.Enabled = true
+		return true
+	}
+	enabled := st.recentExcludes >= minYield*st.recentMicros
+	if enabled != st.Enabled {
+		st.Enabled = enabled
+		st.Toggles++
+	}
+	if enabled {
+		return true
+	}
+	st.skipStreak++
+	if st.skipStreak >= ruleProbeInterval {
+		st.skipStreak = 0
+		return true
+	}
+	st.Skipped++
+	return false
+}
+
+func (st *RuleStats) record(excludes int, cost time.Duration) {
+	st.Calls++
+	st.Excludes += excludes
+	st.Cost += cost
+	st.recentExcludes = st.recentExcludes*ruleDecay + float64(excludes)
+	st.recentMicros = st.recentMicros*ruleDecay + float64(cost)/float64(time.Microsecond)
+}
+
+func (st *RuleStats) add(x *RuleStats) {
+	st.Calls += x.Calls
+	st.Skipped += x.Skipped
+	st.Excludes += x.Excludes
+	st.Cost += x.Cost
+	st.Toggles += x.Toggles
+	st.Enabled = st.Enabled || x.Enabled
+}
+
+// applyRules 应用复杂排除规则，返回新增排除的数量。
+// AdaptiveRules 为 true 时只应用最近收益足够高的规则，并记录每类规则的统计。
+func (ctx *SudokuContext) applyRules(s *Situation, t *Trigger) (changed int) {
+	if !ctx.AdaptiveRules {
+		return s.ApplyExcludeRules(t)
+	}
+	minYield := ctx.MinRuleYield
+	if minYield == 0 {
+		minYield = defaultMinRuleYield
+	}
+	dirty := s.takeDirty()
+	for i, family := range ruleFamilies {
+		st := &ctx.ruleStats[i]
+		if !st.shouldApply(minYield) {
+			//保留这类规则没有检查的标记，再次启用时检查
+			s.skippedDirty[i] = s.skippedDirty[i].or(dirty)
+			continue
+		}
+		startTime := time.Now()
+		excludes := family.apply(s, t, s.familyDirty(i, dirty))
+		st.record(excludes, time.Since(startTime))
+		changed += excludes
+		if len(t.Conflicts) > 0 {
+			break
+		}
+	}
+	return
+}
+
+// RuleStats 返回每类复杂排除规则的统计，只在 AdaptiveRules 为 true 时有记录
+func (ctx *SudokuContext) RuleStats() []RuleStats {
+	stats := make([]RuleStats, len(ruleFamilies))
+	for i, family := range ruleFamilies {
+		stats[i] = ctx.ruleStats[i]
+		stats[i].Name = family.name
+	}
+	return stats
+}
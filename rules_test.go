@@ -0,0 +1,84 @@
+package main
+
+import "testing"
+
+func TestAdaptiveRules(t *testing.T) {
+	for _, line := range readPuzzleLines(openInput("assets/hardest_1106.txt"))[:30] {
+		s, trg := ParseSituationFromLine(line)
+
+		//MinRuleYield 为负数时总是应用所有规则，与每一代都应用复杂排除规则相同
+		always := &SudokuContext{GensApplyRules: 1 << 30}
+		always.Run(DuplicateSituation(s), DuplicateTrigger(trg))
+		adaptive := &SudokuContext{AdaptiveRules: true, MinRuleYield: -1}
+		adaptive.Run(DuplicateSituation(s), DuplicateTrigger(trg))
+		if *adaptive.solutions[0] != *always.solutions[0] ||
+			adaptive.evalCount != always.evalCount || adaptive.branchCount != always.branchCount {
+			t.Fatalf("规则全部启用时结果应与 GensApplyRules 相同：%s %d %v %d %v", line, adaptive.evalCount, adaptive.branchCount, always.evalCount, always.branchCount)
+		}
+		for _, st := range adaptive.RuleStats() {
+			if st.Skipped != 0 || st.Calls == 0 {
+				t.Fatalf("规则全部启用时不应跳过：%s", st.String())
+			}
+		}
+
+		//收益要求极高时，预热之后只有试用
+		strict := &SudokuContext{AdaptiveRules: true, MinRuleYield: 1e30}
+		strict.Run(s, trg)
+		if *strict.solutions[0] != *always.solutions[0] {
+			t.Fatalf("结果不正确：%s", line)
+		}
+		for _, st := range strict.RuleStats() {
+			if st.Calls > ruleWarmup && st.Skipped < (st.Calls-ruleWarmup)*(ruleProbeInterval-1) {
+				t.Fatalf("收益不足的规则应该被跳过：%s", st.String())
+			}
+		}
+	}
+}
+
+// 沿着搜索树的一条路径，比较只检查有变化部分的 ApplyExcludeRules 与检查全部的结果
+func TestIncrementalRules(t *testing.T) {
+	for _, line := range readPuzzleLines(openInput("assets/hardest_1106.txt"))[:50] {
+		s, trg := ParseSituationFromLine(line)
+		ctx := NewSudokuContext()
+		for ctx.logicalEval(s, trg) && !s.Completed() {
+			full, fullTrg := DuplicateSituation(s), DuplicateTrigger(trg)
+			full.markAllDirty()
+			full.ApplyExcludeRules(fullTrg)
+			s.ApplyExcludeRules(trg)
+			if s.numExcludeMask != full.numExcludeMask || len(trg.Conflicts) != len(fullTrg.Conflicts) {
+				t.Fatalf("增量应用复杂排除规则的结果不同：%s", line)
+			}
+			if trg.confirms.Size() == 0 && len(trg.Conflicts) == 0 {
+				candidates := s.ChooseBranchCell1()
+				s.Set(trg, candidates.Choices[len(candidates.Choices)-1])
+				ReleaseBranchChoices(candidates)
+			}
+		}
+	}
+}
+
+// AdaptiveRules 跳过的规则保留没有检查的标记，之后应用全部规则时与检查全部的结果相同
+func TestAdaptiveRulesDirty(t *testing.T) {
+	ctx := &SudokuContext{AdaptiveRules: true, MinRuleYield: 1e9}
+	for _, line := range readPuzzleLines(openInput("assets/hardest_1106.txt"))[:50] {
+		s, trg := ParseSituationFromLine(line)
+		for ctx.logicalEval(s, trg) && !s.Completed() {
+			ctx.applyRules(s, trg)
+			full, fullTrg := DuplicateSituation(s), DuplicateTrigger(trg)
+			full.markAllDirty()
+			full.ApplyExcludeRules(fullTrg)
+			s.ApplyExcludeRules(trg)
+			if s.numExcludeMask != full.numExcludeMask || len(trg.Conflicts) != len(fullTrg.Conflicts) {
+				t.Fatalf("跳过规则后增量应用的结果不同：%s", line)
+			}
+			if trg.confirms.Size() == 0 && len(trg.Conflicts) == 0 {
+				candidates := s.ChooseBranchCell1()
+				s.Set(trg, candidates.Choices[len(candidates.Choices)-1])
+				ReleaseBranchChoices(candidates)
+			}
+		}
+	}
+	if skipped := ctx.RuleStats()[0].Skipped; skipped == 0 {
+		t.Fatal("MinRuleYield 很大时规则应该被跳过")
+	}
+}
@@ -0,0 +1,475 @@
+package main
+
+// SATSolver 把数独编码成 CNF（合取范式），用 CDCL（冲突驱动的子句学习）算法求解。
+//
+// 变量 SudokuVar(r,c,n) 为真代表单元格 (r,c) 填 n。基本约束是：
+// 每个单元格至少填一个数、至多填一个数，每行、列、宫每个数至少出现一次、至多出现一次。
+// 变体谜题的额外约束可以通过 ExtraClauses 加入，例如 AllDifferentClauses 生成的额外互斥组。
+//
+// 与 SudokuContext 分支后就丢弃矛盾不同，CDCL 每次冲突都会学到一个新子句，
+// 同一个矛盾不会在其他分支重复出现。同一个 SATSolver 可以反复使用，但不能并发使用。
+type SATSolver struct {
+	//额外约束，DIMACS 风格：正数 v 代表变量 v 为真，负数 -v 代表变量 v 为假
+	ExtraClauses [][]int
+
+	//基本约束子句数量，clauses[:baseClauses] 在多次求解之间保留
+	baseClauses int
+	clauses     [][]satLit
+	//watches[lit] 是监视 lit 的子句，lit 变为假时检查这些子句
+	watches [][]int32
+
+	//assigns[v]：0 未赋值，1 真，-1 假
+	assigns  []int8
+	level    []int32
+	reason   []int32
+	trail    []satLit
+	trailLim []int32
+	qhead    int
+
+	activity []float64
+	varInc   float64
+	polarity []bool
+	seen     []bool
+
+	solution [9][9]int8
+	stats    SolverStats
+}
+
+// satLit 是文字，变量 v 的正文字为 v*2，负文字为 v*2+1
+type satLit int32
+
+func (l satLit) variable() int32 {
+	return int32(l >> 1)
+}
+
+func (l satLit) neg() satLit {
+	return l ^ 1
+}
+
+func dimacsLit(x int) satLit {
+	if x > 0 {
+		return satLit(x * 2)
+	}
+	return satLit(-x*2 + 1)
+}
+
+const satVars = 729
+
+// SudokuVar 返回"单元格 (r,c) 填 n"对应的 SAT 变量编号（1~729）
+func SudokuVar(r, c, n int8) int {
+	return int(r)*81 + int(c)*9 + int(n) + 1
+}
+
+// AllDifferentClauses 返回 cells 中任意两个单元格不能填相同数字的子句
+func AllDifferentClauses(cells []RowCol) [][]int {
+	var clauses [][]int
+	for i := range cells {
+		for j := i + 1; j < len(cells); j++ {
+			for _n := range loop9 {
+				n := int8(_n)
+				clauses = append(clauses, []int{
+					-SudokuVar(cells[i].Row, cells[i].Col, n),
+					-SudokuVar(cells[j].Row, cells[j].Col, n),
+				})
+			}
+		}
+	}
+	return clauses
+}
+
+// houseExactlyOneClauses 返回9个单元格恰好各填一次1~9的子句
+func houseExactlyOneClauses(cells []RowCol) [][]int {
+	clauses := AllDifferentClauses(cells)
+	for _n := range loop9 {
+		n := int8(_n)
+		clause := make([]int, 0, len(cells))
+		for _, rc := range cells {
+			clause = append(clause, SudokuVar(rc.Row, rc.Col, n))
+		}
+		clauses = append(clauses, clause)
+	}
+	return clauses
+}
+
+func NewSATSolver() *SATSolver {
+	x := &SATSolver{
+		watches:  make([][]int32, (satVars+1)*2),
+		assigns:  make([]int8, satVars+1),
+		level:    make([]int32, satVars+1),
+		reason:   make([]int32, satVars+1),
+		activity: make([]float64, satVars+1),
+		polarity: make([]bool, satVars+1),
+		seen:     make([]bool, satVars+1),
+	}
+
+	var base [][]int
+	for _r := range loop9 {
+		for _c := range loop9 {
+			r, c := int8(_r), int8(_c)
+			atLeastOne := make([]int, 0, 9)
+			for _n := range loop9 {
+				n := int8(_n)
+				atLeastOne = append(atLeastOne, SudokuVar(r, c, n))
+				for n2 := n + 1; n2 < 9; n2++ {
+					base = append(base, []int{-SudokuVar(r, c, n), -SudokuVar(r, c, n2)})
+				}
+			}
+			base = append(base, atLeastOne)
+		}
+	}
+	for _i := range loop9 {
+		i := int8(_i)
+		var row, col, block []RowCol
+		for _j := range loop9 {
+			j := int8(_j)
+			r, c := rcbp(i, j)
+			row = append(row, RowCol{i, j})
+			col = append(col, RowCol{j, i})
+			block = append(block, RowCol{r, c})
+		}
+		base = append(base, houseExactlyOneClauses(row)...)
+		base = append(base, houseExactlyOneClauses(col)...)
+		base = append(base, houseExactlyOneClauses(block)...)
+	}
+	for _, clause := range base {
+		lits := make([]satLit, len(clause))
+		for i, x := range clause {
+			lits[i] = dimacsLit(x)
+		}
+		x.clauses = append(x.clauses, lits)
+	}
+	x.baseClauses = len(x.clauses)
+	return x
+}
+
+func (x *SATSolver) value(l satLit) int8 {
+	v := x.assigns[l.variable()]
+	if l&1 == 1 {
+		return -v
+	}
+	return v
+}
+
+func (x *SATSolver) decisionLevel() int32 {
+	return int32(len(x.trailLim))
+}
+
+// enqueue 把 l 赋值为真，如果 l 已经是假返回 false
+func (x *SATSolver) enqueue(l satLit, reason int32) bool {
+	switch x.value(l) {
+	case 1:
+		return true
+	case -1:
+		return false
+	}
+	v := l.variable()
+	if l&1 == 1 {
+		x.assigns[v] = -1
+	} else {
+		x.assigns[v] = 1
+	}
+	x.level[v] = x.decisionLevel()
+	x.reason[v] = reason
+	x.trail = append(x.trail, l)
+	return true
+}
+
+// attach 监视子句 ci 的前两个文字
+func (x *SATSolver) attach(ci int32) {
+	cl := x.clauses[ci]
+	x.watches[cl[0]] = append(x.watches[cl[0]], ci)
+	x.watches[cl[1]] = append(x.watches[cl[1]], ci)
+}
+
+// addClause 在第0层加入子句，返回 false 表示已经矛盾
+func (x *SATSolver) addClause(lits []satLit) bool {
+	switch len(lits) {
+	case 0:
+		return false
+	case 1:
+		return x.enqueue(lits[0], -1)
+	}
+	x.clauses = append(x.clauses, lits)
+	x.attach(int32(len(x.clauses) - 1))
+	return true
+}
+
+func (x *SATSolver) reset() {
+	x.clauses = x.clauses[:x.baseClauses]
+	for i := range x.watches {
+		x.watches[i] = x.watches[i][:0]
+	}
+	for ci := range x.clauses {
+		if len(x.clauses[ci]) > 1 {
+			x.attach(int32(ci))
+		}
+	}
+	for v := range x.assigns {
+		x.assigns[v] = 0
+		x.activity[v] = 0
+		x.polarity[v] = false
+	}
+	x.trail = x.trail[:0]
+	x.trailLim = x.trailLim[:0]
+	x.qhead = 0
+	x.varInc = 1
+}
+
+// propagate 单元传播，返回冲突子句的下标，没有冲突返回 -1
+func (x *SATSolver) propagate() int32 {
+	for x.qhead < len(x.trail) {
+		falseLit := x.trail[x.qhead].neg()
+		x.qhead++
+		x.stats.EvalCount++
+
+		ws := x.watches[falseLit]
+		kept := ws[:0]
+		for i := 0; i < len(ws); i++ {
+			ci := ws[i]
+			cl := x.clauses[ci]
+			if cl[0] == falseLit {
+				cl[0], cl[1] = cl[1], cl[0]
+			}
+			if x.value(cl[0]) == 1 {
+				kept = append(kept, ci)
+				continue
+			}
+			moved := false
+			for k := 2; k < len(cl); k++ {
+				if x.value(cl[k]) != -1 {
+					cl[1], cl[k] = cl[k], cl[1]
+					x.watches[cl[1]] = append(x.watches[cl[1]], ci)
+					moved = true
+					break
+				}
+			}
+			if moved {
+				continue
+			}
+			kept = append(kept, ci)
+			if !x.enqueue(cl[0], ci) {
+				kept = append(kept, ws[i+1:]...)
+				x.watches[falseLit] = kept
+				x.qhead = len(x.trail)
+				return ci
+			}
+		}
+		x.watches[falseLit] = kept
+	}
+	return -1
+}
+
+func (x *SATSolver) bumpActivity(v int32) {
+	x.activity[v] += x.varInc
+	if x.activity[v] > 1e100 {
+		for i := range x.activity {
+			x.activity[i] *= 1e-100
+		}
+		x.varInc *= 1e-100
+	}
+}
+
+// analyze 从冲突子句推导出 1UIP 学习子句，返回学习子句和回跳的层数
+func (x *SATSolver) analyze(confl int32) ([]satLit, int32) {
+	learnt := []satLit{0}
+	pathCount := 0
+	p := satLit(-1)
+	idx := len(x.trail) - 1
+
+	for {
+		cl := x.clauses[confl]
+		start := 0
+		if p != -1 {
+			start = 1
+		}
+		for _, q := range cl[start:] {
+			v := q.variable()
+			if x.seen[v] || x.level[v] == 0 {
+				continue
+			}
+			x.seen[v] = true
+			x.bumpActivity(v)
+			if x.level[v] >= x.decisionLevel() {
+				pathCount++
+			} else {
+				learnt = append(learnt, q)
+			}
+		}
+		for !x.seen[x.trail[idx].variable()] {
+			idx--
+		}
+		p = x.trail[idx]
+		idx--
+		confl = x.reason[p.variable()]
+		x.seen[p.variable()] = false
+		pathCount--
+		if pathCount == 0 {
+			break
+		}
+	}
+	learnt[0] = p.neg()
+
+	btLevel := int32(0)
+	for i := 1; i < len(learnt); i++ {
+		if lv := x.level[learnt[i].variable()]; lv > btLevel {
+			btLevel = lv
+			learnt[1], learnt[i] = learnt[i], learnt[1]
+		}
+	}
+	for _, q := range learnt {
+		x.seen[q.variable()] = false
+	}
+	x.varInc /= 0.95
+	return learnt, btLevel
+}
+
+func (x *SATSolver) backtrack(lv int32) {
+	if x.decisionLevel() <= lv {
+		return
+	}
+	for i := len(x.trail) - 1; i >= int(x.trailLim[lv]); i-- {
+		v := x.trail[i].variable()
+		x.polarity[v] = x.trail[i]&1 == 1
+		x.assigns[v] = 0
+	}
+	x.trail = x.trail[:x.trailLim[lv]]
+	x.trailLim = x.trailLim[:lv]
+	x.qhead = len(x.trail)
+}
+
+// pickBranchLit 选择活跃度最高的未赋值变量，沿用它上次的取值
+func (x *SATSolver) pickBranchLit() (satLit, bool) {
+	best := int32(-1)
+	for v := int32(1); v <= satVars; v++ {
+		if x.assigns[v] == 0 && (best == -1 || x.activity[v] > x.activity[best]) {
+			best = v
+		}
+	}
+	if best == -1 {
+		return 0, false
+	}
+	l := satLit(best * 2)
+	if x.polarity[best] {
+		l = l.neg()
+	}
+	return l, true
+}
+
+// luby 返回 Luby 重启序列的第 i 项（从0开始）：1,1,2,1,1,2,4,...
+func luby(i int) int {
+	size, seq := 1, 0
+	for size < i+1 {
+		seq++
+		size = 2*size + 1
+	}
+	for size-1 != i {
+		size = (size - 1) >> 1
+		seq--
+		i = i % size
+	}
+	return 1 << seq
+}
+
+// search 搜索下一个满足所有子句的赋值。
+// 返回 1 找到解，0 达到冲突次数上限需要重启，-1 无解。
+func (x *SATSolver) search(conflictLimit int) int {
+	conflicts := 0
+	for {
+		confl := x.propagate()
+		if confl >= 0 {
+			conflicts++
+			if x.decisionLevel() == 0 {
+				return -1
+			}
+			learnt, btLevel := x.analyze(confl)
+			x.backtrack(btLevel)
+			if len(learnt) == 1 {
+				x.enqueue(learnt[0], -1)
+			} else {
+				x.clauses = append(x.clauses, learnt)
+				ci := int32(len(x.clauses) - 1)
+				x.attach(ci)
+				x.enqueue(learnt[0], ci)
+			}
+			continue
+		}
+		if conflicts >= conflictLimit {
+			x.backtrack(0)
+			return 0
+		}
+		l, ok := x.pickBranchLit()
+		if !ok {
+			return 1
+		}
+		x.stats.BranchCount[2]++
+		x.trailLim = append(x.trailLim, int32(len(x.trail)))
+		x.enqueue(l, -1)
+	}
+}
+
+func (x *SATSolver) Solve(puzzle *[9][9]int8, yield func(solution *[9][9]int8) bool) int {
+	x.reset()
+	x.stats = SolverStats{}
+
+	ok := true
+	for _, clause := range x.ExtraClauses {
+		lits := make([]satLit, len(clause))
+		for i, v := range clause {
+			lits[i] = dimacsLit(v)
+		}
+		ok = ok && x.addClause(lits)
+	}
+	for _r := range loop9 {
+		for _c := range loop9 {
+			r, c := int8(_r), int8(_c)
+			if n := puzzle[r][c]; n >= 0 {
+				ok = ok && x.enqueue(dimacsLit(SudokuVar(r, c, n)), -1)
+			}
+		}
+	}
+	if !ok {
+		return 0
+	}
+
+	count := 0
+	for restarts := 0; ; restarts++ {
+		result := x.search(luby(restarts) * 100)
+		if result < 0 {
+			return count
+		}
+		if result == 0 {
+			continue
+		}
+
+		count++
+		var blocking []satLit
+		for _r := range loop9 {
+			for _c := range loop9 {
+				r, c := int8(_r), int8(_c)
+				for _n := range loop9 {
+					n := int8(_n)
+					v := SudokuVar(r, c, n)
+					if x.assigns[v] != 1 {
+						continue
+					}
+					x.solution[r][c] = n
+					if x.level[v] > 0 {
+						blocking = append(blocking, dimacsLit(-v))
+					}
+				}
+			}
+		}
+		if yield != nil && !yield(&x.solution) {
+			return count
+		}
+		//加入排除当前解的子句，继续寻找下一个解
+		x.backtrack(0)
+		if !x.addClause(blocking) {
+			return count
+		}
+	}
+}
+
+func (x *SATSolver) Stats() SolverStats {
+	return x.stats
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSATCrossCheck(t *testing.T) {
+	sat := NewSATSolver()
+	oracle := NewDLXSolver()
+	for _, file := range []string{"assets/17_clue.txt", "assets/hardest_1106.txt", "assets/hardest_1905_11.txt"} {
+		lines := readPuzzleLines(openInput(file))
+		for _, line := range lines[:50] {
+			puzzle, err := ParseCellsFromLine(line)
+			check(err)
+			crossCheckSolvers(t, sat, oracle, puzzle)
+		}
+	}
+
+	raw, err := os.ReadFile("puzzles/hard-02.txt")
+	check(err)
+	multi, _ := ParseSituation(".........\n" + string(raw[10:]))
+	crossCheckSolvers(t, sat, oracle, &multi.cells)
+
+	conflict, _ := ParseSituation("11.......")
+	crossCheckSolvers(t, sat, oracle, &conflict.cells)
+}
+
+func TestSATExtraClauses(t *testing.T) {
+	//对角线数独：两条对角线也不能有重复数字
+	var diag1, diag2 []RowCol
+	for _i := range loop9 {
+		i := int8(_i)
+		diag1 = append(diag1, RowCol{i, i})
+		diag2 = append(diag2, RowCol{i, 8 - i})
+	}
+	sat := NewSATSolver()
+	sat.ExtraClauses = append(AllDifferentClauses(diag1), AllDifferentClauses(diag2)...)
+
+	s, _ := ParseSituation(multiSolutionPuzzle)
+	count := sat.Solve(&s.cells, func(solution *[9][9]int8) bool {
+		var used1, used2 int16
+		for i := range loop9 {
+			used1 |= 1 << solution[i][i]
+			used2 |= 1 << solution[i][8-i]
+		}
+		if used1 != 511 || used2 != 511 || !isSolutionOf(&s.cells, solution) {
+			t.Fatalf("解不满足对角线约束：%s", FormatCellsLine(solution))
+		}
+		return true
+	})
+	if count == 0 {
+		t.Fatal("应该有满足对角线约束的解")
+	}
+	t.Logf("满足对角线约束的解：%d 个", count)
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"fmt"
-	"hash/crc64"
 	"strconv"
 	"strings"
 	"sync"
@@ -19,6 +18,9 @@ type Situation struct {
 	//已填单元格总数
 	setCount int
 
+	//已填单元格的 Zobrist 散列，见 Hash
+	hash uint64
+
 	//numSetCount[n] = x ： n 已填充 x 次
 	numSetCount [9]int8
 	//rowSetCount[r] = x ： r 行已填充 x 个数
@@ -43,8 +45,21 @@ type Situation struct {
 	//blockExcludeMask[n][b] 的每一位代表 宫 b 排除了哪些单元格
 	blockExcludeMask [9][9]int16
 
+	//复杂排除规则需要重新检查的数字、行、列、宫，每一位代表一个。
+	//相关的掩码改变时标记，ApplyExcludeRules 只检查标记过的部分
+	dirtyNums, dirtyRows, dirtyCols, dirtyBlocks int16
+	//AdaptiveRules 跳过某类规则时，这类规则没有检查的标记保留在 skippedDirty 中，下次应用时一并检查
+	skippedDirty [ruleFamilyCount]ruleDirty
+
 	//分支代数，每执行一次Copy就加1
 	branchGeneration int
+
+	//不为 nil 时，填数还按反马步、反王步、非连续等规则排除，见 SetMoveRules
+	moves *MoveRules
+	//不为 nil 时，开始时按偶数格、奇数格、堡垒格排除，填数和排除时按堡垒格的大小关系排除，见 SetCellAttrs
+	attrs *CellAttrs
+	//不为 nil 时，填数和排除还按变体谜题的额外的房和同伴排除，没有待填的数时应用变体约束，见 SetVariantRules
+	variant *VariantRules
 }
 
 // 初始化一个数独谜题
@@ -83,6 +98,20 @@ func ParseSituationFromLine(line []byte) (*Situation, *Trigger) {
 	return s, t
 }
 
+// 从单元格数组初始化一个数独谜题，-1 代表空单元格
+func NewSituationFromCells(cells *[9][9]int8) (*Situation, *Trigger) {
+	s := NewSituation()
+	t := NewTrigger()
+	for r := range loop9 {
+		for c := range loop9 {
+			if n := cells[r][c]; n >= 0 {
+				s.Set(t, RCN(int8(r), int8(c), n))
+			}
+		}
+	}
+	return s, t
+}
+
 var situationPool = sync.Pool{
 	New: func() any {
 		return new(Situation)
@@ -96,6 +125,7 @@ var EmptySituation = func() *Situation {
 			s.cells[r][c] = -1
 		}
 	}
+	s.markAllDirty()
 	return s
 }()
 
@@ -130,6 +160,10 @@ func (s *Situation) Set(t *Trigger, rcn RowColNum) bool {
 		return false
 	}
 	s.cells[r][c] = n
+	s.hash ^= zobristKeys[r][c][n]
+	if t.trail != nil {
+		t.trail.sets = append(t.trail.sets, rcn)
+	}
 
 	var (
 		R, C         = r / 3, c / 3
@@ -145,93 +179,109 @@ func (s *Situation) Set(t *Trigger, rcn RowColNum) bool {
 		rrm    int16 = 07 << (rr * 3)
 	)
 
+	//填数会排除同一单元格的其他数字，以及同行、列、宫其他单元格的 n：
+	//标记这些数字，和可以填 n 的单元格所在的行、列，以及同一带、栈的宫
+	s.dirtyNums |= ^s.numExcludeMask[r][c] | nm
+	s.dirtyRows |= ^s.colExcludeMask[n][c] | Rm
+	s.dirtyCols |= ^s.rowExcludeMask[n][r] | Cm
+	s.dirtyBlocks |= 07<<(R*3) | 0111<<C
+
 	s.setCount++
 	s.numSetCount[n]++
 	s.rowSetCount[r]++
 	s.colSetCount[c]++
 	s.blockSetCount[b]++
 
-	if !setInt16(&s.numExcludeMask[r][c], skip9mask[n]) {
+	if !t.setInt16(&s.numExcludeMask[r][c], skip9mask[n]) {
 		for _, n0 := range loop9skip[n] {
-			if setInt8(&s.cellExclude[n0][r][c], 1) {
+			if t.setInt8(&s.cellExclude[n0][r][c], 1) {
 				continue
 			}
-			if rcn, confirm := s.applyRowMask(n0, r, cm); confirm {
+			if rcn, confirm := s.applyRowMask(t, n0, r, cm); confirm {
 				s.confirmRow(t, rcn)
 			}
-			if rcn, confirm := s.applyColMask(n0, c, rm); confirm {
+			if rcn, confirm := s.applyColMask(t, n0, c, rm); confirm {
 				s.confirmCol(t, rcn)
 			}
-			if bpn, confirm := s.applyBlockMask(n0, b, pm); confirm {
+			if bpn, confirm := s.applyBlockMask(t, n0, b, pm); confirm {
 				s.confirmBlock(t, bpn)
 			}
 		}
 	}
-	if !setInt16(&s.rowExcludeMask[n][r], skip9mask[c]) {
+	if !t.setInt16(&s.rowExcludeMask[n][r], skip9mask[c]) {
 		for _, c0 := range loop9skip3[C] {
-			if setInt8(&s.cellExclude[n][r][c0], 1) {
+			if t.setInt8(&s.cellExclude[n][r][c0], 1) {
 				continue
 			}
-			if rcn, confirm := s.applyNumMask(r, c0, nm); confirm {
+			if rcn, confirm := s.applyNumMask(t, r, c0, nm); confirm {
 				s.confirmNum(t, rcn)
 			}
-			if rcn, confirm := s.applyColMask(n, c0, rm); confirm {
+			if rcn, confirm := s.applyColMask(t, n, c0, rm); confirm {
 				s.confirmCol(t, rcn)
 			}
 		}
 		for _, C0 := range loop3skip[C] {
-			if bpn, confirm := s.applyBlockMask(n, R*3+C0, rrm); confirm {
+			if bpn, confirm := s.applyBlockMask(t, n, R*3+C0, rrm); confirm {
 				s.confirmBlock(t, bpn)
 			}
 		}
 	}
-	if !setInt16(&s.colExcludeMask[n][c], skip9mask[r]) {
+	if !t.setInt16(&s.colExcludeMask[n][c], skip9mask[r]) {
 		for _, r0 := range loop9skip3[R] {
-			if setInt8(&s.cellExclude[n][r0][c], 1) {
+			if t.setInt8(&s.cellExclude[n][r0][c], 1) {
 				continue
 			}
-			if rcn, confirm := s.applyNumMask(r0, c, nm); confirm {
+			if rcn, confirm := s.applyNumMask(t, r0, c, nm); confirm {
 				s.confirmNum(t, rcn)
 			}
-			if rcn, confirm := s.applyRowMask(n, r0, cm); confirm {
+			if rcn, confirm := s.applyRowMask(t, n, r0, cm); confirm {
 				s.confirmRow(t, rcn)
 			}
 		}
 		for _, R0 := range loop3skip[R] {
-			if bpn, confirm := s.applyBlockMask(n, R0*3+C, ccm); confirm {
+			if bpn, confirm := s.applyBlockMask(t, n, R0*3+C, ccm); confirm {
 				s.confirmBlock(t, bpn)
 			}
 		}
 	}
-	if !setInt16(&s.blockExcludeMask[n][b], skip9mask[p]) {
+	if !t.setInt16(&s.blockExcludeMask[n][b], skip9mask[p]) {
 		for _, p0 := range loop9skip[p] {
 			r0, c0 := rcbp(b, p0)
-			if setInt8(&s.cellExclude[n][r0][c0], 1) {
+			if t.setInt8(&s.cellExclude[n][r0][c0], 1) {
 				continue
 			}
-			if rcn, confirm := s.applyNumMask(r0, c0, nm); confirm {
+			if rcn, confirm := s.applyNumMask(t, r0, c0, nm); confirm {
 				s.confirmNum(t, rcn)
 			}
 		}
 		for _, rr0 := range loop3skip[rr] {
 			r0 := R*3 + rr0
-			if rcn, confirm := s.applyRowMask(n, r0, Cm); confirm {
+			if rcn, confirm := s.applyRowMask(t, n, r0, Cm); confirm {
 				s.confirmRow(t, rcn)
 			}
 		}
 		for _, cc0 := range loop3skip[cc] {
 			c0 := C*3 + cc0
-			if rcn, confirm := s.applyColMask(n, c0, Rm); confirm {
+			if rcn, confirm := s.applyColMask(t, n, c0, Rm); confirm {
 				s.confirmCol(t, rcn)
 			}
 		}
 	}
+	if s.moves != nil {
+		s.applyMoveRules(t, r, c, n)
+	}
+	if s.attrs != nil {
+		s.applyCellAttrs(t, r, c)
+	}
+	if s.variant != nil {
+		s.applyVariantSet(t, r, c, n)
+	}
 
 	return true
 }
 
-func (s *Situation) applyNumMask(r, c int8, mask int16) (RowColNum, bool) {
-	n0 := pos0(bitwiseOr(&s.numExcludeMask[r][c], mask))
+func (s *Situation) applyNumMask(t *Trigger, r, c int8, mask int16) (RowColNum, bool) {
+	n0 := pos0(t.bitwiseOr(&s.numExcludeMask[r][c], mask))
 	return RCN(r, c, n0), n0 != -2
 }
 
@@ -243,8 +293,8 @@ func (s *Situation) confirmNum(t *Trigger, rcn RowColNum) {
 	}
 }
 
-func (s *Situation) applyRowMask(n, r int8, mask int16) (RowColNum, bool) {
-	c0 := pos0(bitwiseOr(&s.rowExcludeMask[n][r], mask))
+func (s *Situation) applyRowMask(t *Trigger, n, r int8, mask int16) (RowColNum, bool) {
+	c0 := pos0(t.bitwiseOr(&s.rowExcludeMask[n][r], mask))
 	return RCN(r, c0, n), c0 != -2
 }
 
@@ -256,8 +306,8 @@ func (s *Situation) confirmRow(t *Trigger, rcn RowColNum) {
 	}
 }
 
-func (s *Situation) applyColMask(n, c int8, mask int16) (RowColNum, bool) {
-	r0 := pos0(bitwiseOr(&s.colExcludeMask[n][c], mask))
+func (s *Situation) applyColMask(t *Trigger, n, c int8, mask int16) (RowColNum, bool) {
+	r0 := pos0(t.bitwiseOr(&s.colExcludeMask[n][c], mask))
 	return RCN(r0, c, n), r0 != -2
 }
 
@@ -269,8 +319,8 @@ func (s *Situation) confirmCol(t *Trigger, rcn RowColNum) {
 	}
 }
 
-func (s *Situation) applyBlockMask(n, b int8, mask int16) (BlockPosNum, bool) {
-	p0 := pos0(bitwiseOr(&s.blockExcludeMask[n][b], mask))
+func (s *Situation) applyBlockMask(t *Trigger, n, b int8, mask int16) (BlockPosNum, bool) {
+	p0 := pos0(t.bitwiseOr(&s.blockExcludeMask[n][b], mask))
 	return BPN(b, p0, n), p0 != -2
 }
 
@@ -283,19 +333,51 @@ func (s *Situation) confirmBlock(t *Trigger, bpn BlockPosNum) {
 	}
 }
 
+// ApplyExcludeRules 依次应用所有复杂排除规则（见 ruleFamilies），返回新增排除的数量。
+// 只检查上次应用之后掩码有变化的数字、行、列、宫。
 func (s *Situation) ApplyExcludeRules(t *Trigger) (changed int) {
-	changed += s.applyDimVariantRule(t, s.getMaskNumRow, s.getMaskNumCol, NRC)
-	changed += s.applyDimVariantRule(t, s.getMaskNumCol, s.getMaskNumRow, NCR)
-	changed += s.applyDimVariantRule(t, s.getMaskRowCol, s.getMaskRowNum, RCN)
-	changed += s.applyDimVariantRule(t, s.getMaskRowNum, s.getMaskRowCol, RNC)
-	changed += s.applyDimVariantRule(t, s.getMaskColNum, s.getMaskColRow, CNR)
-	changed += s.applyDimVariantRule(t, s.getMaskColRow, s.getMaskColNum, CRN)
-	changed += s.applyDimVariantRule(t, s.getMaskBlockNum, s.getMaskBlockPos, BNPtoRCN)
-	changed += s.applyDimVariantRule(t, s.getMaskBlockPos, s.getMaskBlockNum, BPNtoRCN)
-	changed += s.applyBlockRules(t)
+	dirty := s.takeDirty()
+	for i, family := range ruleFamilies {
+		changed += family.apply(s, t, s.familyDirty(i, dirty))
+	}
 	return
 }
 
+// ruleDirty 是一次应用复杂排除规则时需要检查的数字、行、列、宫
+type ruleDirty struct {
+	nums, rows, cols, blocks int16
+}
+
+// takeDirty 取出并清除局势的标记。
+// 规则自身的排除会重新标记，所以每类规则应使用 merge 的结果，以便检查前面的规则刚改变的部分。
+func (s *Situation) takeDirty() ruleDirty {
+	d := ruleDirty{s.dirtyNums, s.dirtyRows, s.dirtyCols, s.dirtyBlocks}
+	s.dirtyNums, s.dirtyRows, s.dirtyCols, s.dirtyBlocks = 0, 0, 0, 0
+	return d
+}
+
+// merge 返回 d 与局势 s 当前标记的并集，s 的标记保留到下一次应用
+func (d ruleDirty) merge(s *Situation) ruleDirty {
+	return d.or(ruleDirty{s.dirtyNums, s.dirtyRows, s.dirtyCols, s.dirtyBlocks})
+}
+
+func (d ruleDirty) or(x ruleDirty) ruleDirty {
+	return ruleDirty{d.nums | x.nums, d.rows | x.rows, d.cols | x.cols, d.blocks | x.blocks}
+}
+
+// familyDirty 返回第 i 类规则需要检查的部分：takeDirty 取出的标记 d、此后的新标记，
+// 以及这类规则之前被跳过时保留的标记，并清除保留的标记
+func (s *Situation) familyDirty(i int, d ruleDirty) ruleDirty {
+	d = d.merge(s).or(s.skippedDirty[i])
+	s.skippedDirty[i] = ruleDirty{}
+	return d
+}
+
+// markAllDirty 标记所有数字、行、列、宫需要检查
+func (s *Situation) markAllDirty() {
+	s.dirtyNums, s.dirtyRows, s.dirtyCols, s.dirtyBlocks = 511, 511, 511, 511
+}
+
 func (s *Situation) getMaskNumRow(n, r int8) *int16 {
 	return &s.rowExcludeMask[n][r]
 }
@@ -332,21 +414,34 @@ func (s *Situation) getMaskBlockPos(b, p int8) *int16 {
 type getMaskFunc func(x, y int8) *int16
 type getRowColNumFunc func(x, y, z int8) RowColNum
 
-func (s *Situation) applyDimVariantRule(t *Trigger, getMaskDim1Dim2, getMaskDim1Dim3 getMaskFunc, getRCN getRowColNumFunc) (changed int) {
+func (s *Situation) applyDimVariantRule(t *Trigger, dirty int16, getMaskDim1Dim2, getMaskDim1Dim3 getMaskFunc, getRCN getRowColNumFunc) (changed int) {
 	for _dim1 := range loop9 {
 		dim1 := int8(_dim1)
-		var checkMap [1 << 9]int8
+		if dirty&(1<<dim1) == 0 {
+			continue
+		}
+		//已经找到的只剩两个候选的 dim3mask 和对应的 dim2
+		var seenMasks [9]int16
+		var seenDim2 [9]int8
+		seen := 0
 		for _dim2 := range loop9 {
 			dim2b := int8(_dim2)
 			dim3mask := *getMaskDim1Dim2(dim1, dim2b)
 			if countTrueBits(dim3mask) != 7 {
 				continue
 			}
-			if checkMap[dim3mask] == 0 {
-				checkMap[dim3mask] = dim2b + 1
+			dim2a := int8(-1)
+			for i := range seen {
+				if seenMasks[i] == dim3mask {
+					dim2a = seenDim2[i]
+					break
+				}
+			}
+			if dim2a < 0 {
+				seenMasks[seen], seenDim2[seen] = dim3mask, dim2b
+				seen++
 				continue
 			}
-			dim2a := checkMap[dim3mask] - 1
 
 			dim2skipMask := skip9mask[dim2a] & skip9mask[dim2b]
 			for _dim3 := range loop9 {
@@ -375,9 +470,12 @@ func (s *Situation) applyDimVariantRule(t *Trigger, getMaskDim1Dim2, getMaskDim1
 	return
 }
 
-func (s *Situation) applyBlockRules(t *Trigger) (changed int) {
+func (s *Situation) applyBlockRules(t *Trigger, dirtyNums int16) (changed int) {
 	for _n := range loop9 {
 		n := int8(_n)
+		if dirtyNums&(1<<n) == 0 {
+			continue
+		}
 		for _r := range loop9 {
 			r := int8(_r)
 			rr := r % 3
@@ -420,22 +518,34 @@ func (s *Situation) applyBlockRules(t *Trigger) (changed int) {
 
 func (s *Situation) excludeOne(t *Trigger, rcn RowColNum) int {
 	r, c, n := rcn.Extract()
-	if setInt8(&s.cellExclude[r][c][n], 1) {
+	if t.setInt8(&s.cellExclude[n][r][c], 1) {
 		return 0
 	}
-	if rcn0, confirm := s.applyNumMask(r, c, 1<<n); confirm {
+	b, p := rcbp(r, c)
+	s.dirtyNums |= 1 << n
+	s.dirtyRows |= 1 << r
+	s.dirtyCols |= 1 << c
+	s.dirtyBlocks |= 1 << b
+	if rcn0, confirm := s.applyNumMask(t, r, c, 1<<n); confirm {
 		s.confirmNum(t, rcn0)
 	}
-	if rcn0, confirm := s.applyRowMask(n, r, 1<<c); confirm {
+	if rcn0, confirm := s.applyRowMask(t, n, r, 1<<c); confirm {
 		s.confirmRow(t, rcn0)
 	}
-	if rcn0, confirm := s.applyColMask(n, c, 1<<r); confirm {
+	if rcn0, confirm := s.applyColMask(t, n, c, 1<<r); confirm {
 		s.confirmCol(t, rcn0)
 	}
-	b, p := rcbp(r, c)
-	if bpn0, confirm := s.applyBlockMask(n, b, 1<<p); confirm {
+	if bpn0, confirm := s.applyBlockMask(t, n, b, 1<<p); confirm {
 		s.confirmBlock(t, bpn0)
 	}
+	if s.attrs != nil {
+		s.applyCellAttrs(t, r, c)
+	}
+	if s.variant != nil {
+		for _, h := range s.variant.extraHouses[r][c] {
+			s.checkVariantHouse(t, h, n)
+		}
+	}
 	return 1
 }
 
@@ -568,15 +678,10 @@ func ShowCells(cells *[9][9]int8, title string, r, c int) {
 	}
 }
 
+// Hash 返回已填单元格的 Zobrist 散列：每个 (单元格, 数字) 有一个随机键，散列是所有已填单元格键的异或。
+// Set 和 Trail.Undo 增量更新，不需要重新计算。
 func (s *Situation) Hash() uint64 {
-	raw := make([]byte, 9*9)
-	for r := range loop9 {
-		for c := range loop9 {
-			raw[r*9+c] = byte(s.cells[r][c] + 1)
-		}
-	}
-
-	return crc64.Checksum(raw, crc64.MakeTable(crc64.ISO))
+	return s.hash
 }
 
 func (s *Situation) Completed() bool {
@@ -610,6 +715,9 @@ func DuplicateTrigger(t *Trigger) *Trigger {
 type Trigger struct {
 	confirms  *Queue
 	Conflicts []Conflict
+
+	//不为 nil 时，记录局势的所有修改以便撤销，见 Trail
+	trail *Trail
 }
 
 func (t *Trigger) Init() {
@@ -636,3 +744,39 @@ func (t *Trigger) CopyFrom(x *Trigger) {
 	t.confirms.CopyFrom(x.confirms)
 	t.Conflicts = append(t.Conflicts, x.Conflicts...)
 }
+
+// ShowCandidates 显示每个单元格的候选数，candidates[r][c] 的每一位代表一个候选数
+func ShowCandidates(candidates *[9][9]int16, title string) {
+	width := 1
+	texts := [9][9]string{}
+	for r := range loop9 {
+		for c := range loop9 {
+			txt := ""
+			for n := range loop9 {
+				if candidates[r][c]&(1<<n) != 0 {
+					txt += strconv.Itoa(n + 1)
+				}
+			}
+			if txt == "" {
+				txt = "-"
+			}
+			texts[r][c] = txt
+			width = max(width, len(txt))
+		}
+	}
+	line := strings.Repeat("-", 9*(width+1)+4)
+	fmt.Println(strings.Repeat("=", len(line)))
+	fmt.Println(title)
+	for r := range loop9 {
+		for c := range loop9 {
+			fmt.Printf(" %-*s", width, texts[r][c])
+			if c == 2 || c == 5 {
+				fmt.Printf(" |")
+			}
+		}
+		fmt.Println()
+		if r == 2 || r == 5 {
+			fmt.Println(line)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import "testing"
+
+// excludeOne 与 Set 使用同一个 cellExclude[n][r][c] 标记
+func TestExcludeOneIndex(t *testing.T) {
+	s, trg := ParseSituation("")
+	s.Set(trg, RCN(0, 0, 4))
+	//Set 已经在同一行排除了 5，不是新增排除
+	if changed := s.excludeOne(trg, RCN(0, 5, 4)); changed != 0 {
+		t.Fatalf("重复排除应该返回 0，实际是 %d", changed)
+	}
+	//r6c5 的 1 没有排除过，应该新增排除并标记 cellExclude[0][5][4]
+	if changed := s.excludeOne(trg, RCN(5, 4, 0)); changed != 1 || s.cellExclude[0][5][4] != 1 {
+		t.Fatalf("排除 r6c5 的 1 失败")
+	}
+	if s.numExcludeMask[5][4] != 1 || s.rowExcludeMask[0][5] != 1<<4 || s.colExcludeMask[0][4] != 1<<5 {
+		t.Fatalf("排除 r6c5 的 1 后掩码错误：%09b %09b %09b", s.numExcludeMask[5][4], s.rowExcludeMask[0][5], s.colExcludeMask[0][4])
+	}
+}
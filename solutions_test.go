@@ -0,0 +1,80 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// 谜题 puzzles/simple-01.txt 去掉第7行的线索后有多个解
+const multiSolutionPuzzle = `
+...7.....
+1........
+...43.2..
+........6
+...5.9...
+......418
+.........
+..2....5.
+.4....3..
+`
+
+// isSolutionOf 检查 solution 是有效的终局，并且包含 puzzle 的所有线索
+func isSolutionOf(puzzle, solution *[9][9]int8) bool {
+	var rows, cols, blocks [9]int16
+	for r := range loop9 {
+		for c := range loop9 {
+			n := solution[r][c]
+			if n < 0 || n > 8 || puzzle[r][c] >= 0 && puzzle[r][c] != n {
+				return false
+			}
+			b, _ := rcbp(int8(r), int8(c))
+			rows[r] |= 1 << n
+			cols[c] |= 1 << n
+			blocks[b] |= 1 << n
+		}
+	}
+	for i := range loop9 {
+		if rows[i] != 511 || cols[i] != 511 || blocks[i] != 511 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSolutionsStream(t *testing.T) {
+	s, trg := ParseSituation(multiSolutionPuzzle)
+	givens := s.cells
+
+	limit := 2000
+	seen := make(map[[9][9]int8]bool)
+	ctx := NewSudokuContext()
+	for solution := range ctx.Solutions(DuplicateSituation(s), DuplicateTrigger(trg)) {
+		if !isSolutionOf(&givens, solution) {
+			t.Fatalf("无效的解：%s", FormatCellsLine(solution))
+		}
+		seen[*solution] = true
+		if len(seen) == limit {
+			break
+		}
+	}
+	if len(seen) != limit || len(ctx.solutions) != 0 {
+		t.Fatalf("应该逐个产生 %d 个不同的解且不保存，实际 %d 个，保存 %d 个", limit, len(seen), len(ctx.solutions))
+	}
+}
+
+func TestSampleSolution(t *testing.T) {
+	s, trg := ParseSituation(multiSolutionPuzzle)
+	givens := s.cells
+	rnd := rand.New(rand.NewSource(1))
+	seen := make(map[[9][9]int8]bool)
+	for range 20 {
+		solution, ok := SampleSolution(DuplicateSituation(s), DuplicateTrigger(trg), rnd)
+		if !ok || !isSolutionOf(&givens, solution) {
+			t.Fatal("随机抽取的解无效")
+		}
+		seen[*solution] = true
+	}
+	if len(seen) < 10 {
+		t.Fatalf("随机抽取的解重复太多：20 次只有 %d 个不同的解", len(seen))
+	}
+}
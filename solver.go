@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Solver 是解题算法后端的统一接口，用于比较不同算法的性能，或互相检验结果
+type Solver interface {
+	// Solve 求解 puzzle（-1 代表空单元格），每找到一个解调用一次 yield。
+	// solution 指向的数组在 yield 返回后会被复用，需要保留时应复制一份。
+	// yield 返回 false 表示停止搜索。返回找到的解的数量。
+	Solve(puzzle *[9][9]int8, yield func(solution *[9][9]int8) bool) int
+
+	// Stats 返回最近一次 Solve 的运算统计
+	Stats() SolverStats
+}
+
+// SolverStats 是一次求解的运算统计，含义与 SudokuContext 的统计字段一致
+type SolverStats struct {
+	//BranchCount[x] = y ：有 x 个候选项的分支产生了 y 次
+	BranchCount   [10]int
+	EvalCount     int
+	RulesDebranch int
+}
+
+// SumBranches 返回总分支数
+func (st *SolverStats) SumBranches() int {
+	sum := 0
+	for _, branches := range st.BranchCount {
+		sum += branches
+	}
+	return sum
+}
+
+var solverEngines = map[string]func() Solver{
+	"default": func() Solver { return &PropagationSolver{} },
+	"dlx":     func() Solver { return NewDLXSolver() },
+	"sat":     func() Solver { return NewSATSolver() },
+	"bits":    func() Solver { return NewBitSolver() },
+}
+
+// SolverEngineNames 返回所有可用的算法名称
+func SolverEngineNames() []string {
+	var names []string
+	for name := range solverEngines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewSolver 按名称创建解题算法，空名称代表 "default"
+func NewSolver(engine string) (Solver, error) {
+	if engine == "" {
+		engine = "default"
+	}
+	newSolver, ok := solverEngines[engine]
+	if !ok {
+		return nil, fmt.Errorf("unknown engine %q, available: %v", engine, SolverEngineNames())
+	}
+	return newSolver(), nil
+}
+
+// PropagationSolver 是本项目默认的推理加分支算法（SudokuContext）的 Solver 包装。
+// 它复用同一个 SudokuContext，局势和触发器从池中获取，稳定状态下求解不分配内存（yield 本身除外）。
+type PropagationSolver struct {
+	GensApplyRules int
+	//不为 nil 时，按反马步、反王步、非连续等规则求解
+	Moves *MoveRules
+	//不为 nil 时，按偶数格、奇数格、堡垒格求解
+	Attrs *CellAttrs
+	//不为 nil 时，按变体谜题的规则求解，见 NewVariantRules
+	Variant *VariantRules
+
+	stats SolverStats
+	ctx   SudokuContext
+	//Solve 的回调，为 nil 时把解写入 buffer
+	yield  func(solution *[9][9]int8) bool
+	buffer [][9][9]int8
+	found  int
+	//绑定到 collect 的回调，只创建一次
+	onSolution func(solution *[9][9]int8) bool
+}
+
+func (ps *PropagationSolver) Solve(puzzle *[9][9]int8, yield func(solution *[9][9]int8) bool) int {
+	ps.yield = yield
+	count := ps.solve(puzzle)
+	ps.yield = nil
+	return count
+}
+
+// SolveInto 求解 puzzle，把解依次写入调用者提供的 solutions，写满时停止搜索。
+// 返回找到的解的数量，最多 len(solutions)，solutions 为空时最多为 1（只判断是否有解）。
+// 例如传入长度为 2 的缓冲区可以判断谜题是否有唯一解。
+func (ps *PropagationSolver) SolveInto(puzzle *[9][9]int8, solutions [][9][9]int8) int {
+	ps.buffer = solutions
+	ps.found = 0
+	ps.solve(puzzle)
+	ps.buffer = nil
+	return ps.found
+}
+
+func (ps *PropagationSolver) solve(puzzle *[9][9]int8) int {
+	s, t := NewSituationFromCells(puzzle)
+	defer ReleaseSituation(s)
+	defer ReleaseTrigger(t)
+	s.SetMoveRules(t, ps.Moves)
+	s.SetCellAttrs(t, ps.Attrs)
+	s.SetVariantRules(t, ps.Variant)
+	if ps.onSolution == nil {
+		ps.onSolution = ps.collect
+	}
+	ctx := &ps.ctx
+	ctx.reset()
+	ctx.GensApplyRules = ps.GensApplyRules
+	ctx.OnSolution = ps.onSolution
+	count := ctx.Run(s, t)
+	ps.stats = SolverStats{
+		BranchCount:   ctx.branchCount,
+		EvalCount:     ctx.evalCount,
+		RulesDebranch: ctx.rulesDebranch,
+	}
+	return count
+}
+
+func (ps *PropagationSolver) collect(solution *[9][9]int8) bool {
+	if ps.yield != nil {
+		return ps.yield(solution)
+	}
+	if ps.found < len(ps.buffer) {
+		ps.buffer[ps.found] = *solution
+	}
+	ps.found++
+	return ps.found < len(ps.buffer)
+}
+
+func (ps *PropagationSolver) Stats() SolverStats {
+	return ps.stats
+}
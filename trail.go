@@ -0,0 +1,98 @@
+package main
+
+// Trail 记录局势的修改，用于迭代搜索时撤销到之前的某个时刻，代替分支时复制整个局势。
+//
+// Trigger.trail 不为 nil 时，Set 和 excludeOne 对掩码的每次修改都会先保存旧值，
+// 每次填数也会记下来，撤销时恢复单元格和计数。
+// 记录器放在 Trigger 而不是 Situation 中，使 Situation 不含指针，复制时不需要写屏障。
+type Trail struct {
+	int16s []trailInt16
+	int8s  []trailInt8
+	sets   []RowColNum
+}
+
+type trailInt16 struct {
+	p *int16
+	v int16
+}
+
+type trailInt8 struct {
+	p *int8
+	v int8
+}
+
+// TrailMark 是 Trail 的某个时刻，可以用 Undo 撤销之后的所有修改
+type TrailMark struct {
+	int16s, int8s, sets int
+	//复杂排除规则的标记改变得很频繁，不逐次记录，而是在 Mark 时保存，撤销时整体恢复
+	dirty        ruleDirty
+	skippedDirty [ruleFamilyCount]ruleDirty
+}
+
+// Mark 返回局势 s 当前的时刻，s 的所有修改都应该记录在 tr 中
+func (tr *Trail) Mark(s *Situation) TrailMark {
+	return TrailMark{
+		int16s:       len(tr.int16s),
+		int8s:        len(tr.int8s),
+		sets:         len(tr.sets),
+		dirty:        ruleDirty{s.dirtyNums, s.dirtyRows, s.dirtyCols, s.dirtyBlocks},
+		skippedDirty: s.skippedDirty,
+	}
+}
+
+// Undo 把局势 s 恢复到 mark 时的状态
+func (tr *Trail) Undo(s *Situation, mark TrailMark) {
+	for i := len(tr.int16s) - 1; i >= mark.int16s; i-- {
+		*tr.int16s[i].p = tr.int16s[i].v
+	}
+	for i := len(tr.int8s) - 1; i >= mark.int8s; i-- {
+		*tr.int8s[i].p = tr.int8s[i].v
+	}
+	for i := len(tr.sets) - 1; i >= mark.sets; i-- {
+		r, c, n := tr.sets[i].Extract()
+		b, _ := rcbp(r, c)
+		s.cells[r][c] = -1
+		s.hash ^= zobristKeys[r][c][n]
+		s.setCount--
+		s.numSetCount[n]--
+		s.rowSetCount[r]--
+		s.colSetCount[c]--
+		s.blockSetCount[b]--
+	}
+	s.dirtyNums, s.dirtyRows, s.dirtyCols, s.dirtyBlocks = mark.dirty.nums, mark.dirty.rows, mark.dirty.cols, mark.dirty.blocks
+	s.skippedDirty = mark.skippedDirty
+	tr.int16s = tr.int16s[:mark.int16s]
+	tr.int8s = tr.int8s[:mark.int8s]
+	tr.sets = tr.sets[:mark.sets]
+}
+
+// 以下方法与 util.go 中的同名函数相同，但在 t.trail 不为 nil 时记录旧值
+
+func (t *Trigger) bitwiseOr(p *int16, mask int16) int16 {
+	if t.trail != nil {
+		t.trail.saveInt16(p)
+	}
+	return bitwiseOr(p, mask)
+}
+
+func (t *Trigger) setInt8(p *int8, v int8) bool {
+	if t.trail != nil {
+		t.trail.saveInt8(p)
+	}
+	return setInt8(p, v)
+}
+
+func (t *Trigger) setInt16(p *int16, v int16) bool {
+	if t.trail != nil {
+		t.trail.saveInt16(p)
+	}
+	return setInt16(p, v)
+}
+
+func (tr *Trail) saveInt16(p *int16) {
+	tr.int16s = append(tr.int16s, trailInt16{p, *p})
+}
+
+func (tr *Trail) saveInt8(p *int8) {
+	tr.int8s = append(tr.int8s, trailInt8{p, *p})
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestTrailUndo(t *testing.T) {
+	puzzle, err := os.ReadFile("puzzles/hard-02.txt")
+	check(err)
+	s, trg := ParseSituation(string(puzzle))
+	ctx := NewSudokuContext()
+	ctx.logicalEval(s, trg)
+	before := *s
+
+	trg.trail = &Trail{}
+	mark := trg.trail.Mark(s)
+	s.Set(trg, s.ChooseBranchCell1().Choices[0])
+	ctx.logicalEvalWithRules(s, trg)
+	if *s == before {
+		t.Fatal("填数后局势应该改变")
+	}
+	trg.trail.Undo(s, mark)
+	if *s != before {
+		t.Fatal("撤销后局势应该恢复")
+	}
+}
+
+func TestIterativeEval(t *testing.T) {
+	raw, err := os.ReadFile("puzzles/hard-02.txt")
+	check(err)
+	lines := readPuzzleLines(openInput("assets/hardest_1905_11.txt"))[:100]
+	puzzles := []string{".........\n" + string(raw[10:])}
+	for _, line := range lines {
+		puzzles = append(puzzles, string(line))
+	}
+	for _, puzzle := range puzzles {
+		var contexts [2]*SudokuContext
+		for i, iterative := range []bool{false, true} {
+			var s *Situation
+			var trg *Trigger
+			if len(puzzle) == 81 {
+				s, trg = ParseSituationFromLine([]byte(puzzle))
+			} else {
+				s, trg = ParseSituation(puzzle)
+			}
+			contexts[i] = &SudokuContext{Iterative: iterative, GensApplyRules: 2}
+			contexts[i].Run(s, trg)
+		}
+		recursive, iterative := contexts[0], contexts[1]
+		if len(recursive.solutions) != len(iterative.solutions) ||
+			recursive.evalCount != iterative.evalCount ||
+			recursive.branchCount != iterative.branchCount {
+			t.Fatalf("迭代搜索结果不一致：%s", puzzle)
+		}
+		for i := range recursive.solutions {
+			if *recursive.solutions[i] != *iterative.solutions[i] {
+				t.Fatalf("迭代搜索的解不一致：%s", puzzle)
+			}
+		}
+	}
+}
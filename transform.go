@@ -0,0 +1,322 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// Transform 代表一个保持数独有效性的变换。
+// 应用顺序：先按 Transpose 转置，再按 Rows、Cols 重排行列，最后按 Nums 替换数字。
+type Transform struct {
+	//是否先转置（行列互换）
+	Transpose bool
+
+	//Rows[r] = r0 ：结果的第 r 行取自原局面的第 r0 行
+	Rows [9]int8
+
+	//Cols[c] = c0 ：结果的第 c 列取自原局面的第 c0 列
+	Cols [9]int8
+
+	//Nums[n] = n1 ：原局面的数字 n 替换为 n1
+	Nums [9]int8
+}
+
+// IdentityTransform 返回不做任何改变的变换
+func IdentityTransform() Transform {
+	var tf Transform
+	for i := range loop9 {
+		tf.Rows[i] = int8(i)
+		tf.Cols[i] = int8(i)
+		tf.Nums[i] = int8(i)
+	}
+	return tf
+}
+
+// ApplyCells 对单元格数组应用变换，空单元格（-1）保持为空
+func (tf Transform) ApplyCells(cells *[9][9]int8) *[9][9]int8 {
+	result := new([9][9]int8)
+	for r := range loop9 {
+		for c := range loop9 {
+			r0, c0 := tf.Rows[r], tf.Cols[c]
+			if tf.Transpose {
+				r0, c0 = c0, r0
+			}
+			n := cells[r0][c0]
+			if n >= 0 {
+				n = tf.Nums[n]
+			}
+			result[r][c] = n
+		}
+	}
+	return result
+}
+
+func (tf Transform) String() string {
+	var sb strings.Builder
+	if tf.Transpose {
+		sb.WriteString("T ")
+	}
+	writeDigits := func(name string, values [9]int8) {
+		sb.WriteString(name)
+		sb.WriteByte('=')
+		for _, v := range values {
+			sb.WriteByte(byte('1' + v))
+		}
+	}
+	writeDigits("rows", tf.Rows)
+	sb.WriteByte(' ')
+	writeDigits("cols", tf.Cols)
+	sb.WriteByte(' ')
+	writeDigits("nums", tf.Nums)
+	return sb.String()
+}
+
+// RandomTransform 在全部 2*6^8 = 3359232 种位置变换和 9! 种数字替换中均匀随机选取一个
+func RandomTransform(rnd *rand.Rand) Transform {
+	tf := Transform{Transpose: rnd.Intn(2) == 1}
+	bands := perms3[rnd.Intn(6)]
+	stacks := perms3[rnd.Intn(6)]
+	for i := range loop3 {
+		rows := perms3[rnd.Intn(6)]
+		cols := perms3[rnd.Intn(6)]
+		for j := range loop3 {
+			tf.Rows[i*3+j] = bands[i]*3 + rows[j]
+			tf.Cols[i*3+j] = stacks[i]*3 + cols[j]
+		}
+	}
+	for i, n := range rnd.Perm(9) {
+		tf.Nums[i] = int8(n)
+	}
+	return tf
+}
+
+// RelabelTransform 只替换数字，nums[n] = n1 表示数字 n 替换为 n1
+func RelabelTransform(nums [9]int8) Transform {
+	tf := IdentityTransform()
+	tf.Nums = nums
+	return tf
+}
+
+// SwapRowsTransform 交换带 band 内的第 i 行和第 j 行（都是0~2）
+func SwapRowsTransform(band, i, j int8) Transform {
+	tf := IdentityTransform()
+	tf.Rows[band*3+i], tf.Rows[band*3+j] = tf.Rows[band*3+j], tf.Rows[band*3+i]
+	return tf
+}
+
+// SwapColsTransform 交换栈 stack 内的第 i 列和第 j 列（都是0~2）
+func SwapColsTransform(stack, i, j int8) Transform {
+	tf := IdentityTransform()
+	tf.Cols[stack*3+i], tf.Cols[stack*3+j] = tf.Cols[stack*3+j], tf.Cols[stack*3+i]
+	return tf
+}
+
+// SwapBandsTransform 交换第 a 带和第 b 带（每带3行）
+func SwapBandsTransform(a, b int8) Transform {
+	tf := IdentityTransform()
+	for i := range loop3 {
+		tf.Rows[a*3+int8(i)], tf.Rows[b*3+int8(i)] = tf.Rows[b*3+int8(i)], tf.Rows[a*3+int8(i)]
+	}
+	return tf
+}
+
+// SwapStacksTransform 交换第 a 栈和第 b 栈（每栈3列）
+func SwapStacksTransform(a, b int8) Transform {
+	tf := IdentityTransform()
+	for i := range loop3 {
+		tf.Cols[a*3+int8(i)], tf.Cols[b*3+int8(i)] = tf.Cols[b*3+int8(i)], tf.Cols[a*3+int8(i)]
+	}
+	return tf
+}
+
+// TransposeTransform 沿主对角线转置
+func TransposeTransform() Transform {
+	tf := IdentityTransform()
+	tf.Transpose = true
+	return tf
+}
+
+// RotateTransform 顺时针旋转 quarterTurns 个90度
+func RotateTransform(quarterTurns int) Transform {
+	tf := IdentityTransform()
+	switch (quarterTurns%4 + 4) % 4 {
+	case 1:
+		//result[r][c] = src[8-c][r]
+		tf.Transpose = true
+		for i := range loop9 {
+			tf.Cols[i] = int8(8 - i)
+		}
+	case 2:
+		//result[r][c] = src[8-r][8-c]
+		for i := range loop9 {
+			tf.Rows[i] = int8(8 - i)
+			tf.Cols[i] = int8(8 - i)
+		}
+	case 3:
+		//result[r][c] = src[c][8-r]
+		tf.Transpose = true
+		for i := range loop9 {
+			tf.Rows[i] = int8(8 - i)
+		}
+	}
+	return tf
+}
+
+// Validate 检查变换是否保持数独有效性：
+// Rows、Cols、Nums 都是排列，且行只在带内、带与带之间整体移动（列同理）
+func (tf Transform) Validate() error {
+	checkPerm := func(name string, values [9]int8, keepGroups bool) error {
+		var used int16
+		for i, v := range values {
+			if v < 0 || v > 8 || used&(1<<v) != 0 {
+				return fmt.Errorf("%s is not a permutation", name)
+			}
+			used |= 1 << v
+			if keepGroups && v/3 != values[i/3*3]/3 {
+				return fmt.Errorf("%s breaks 3-line groups", name)
+			}
+		}
+		return nil
+	}
+	if err := checkPerm("rows", tf.Rows, true); err != nil {
+		return err
+	}
+	if err := checkPerm("cols", tf.Cols, true); err != nil {
+		return err
+	}
+	return checkPerm("nums", tf.Nums, false)
+}
+
+// Then 返回先应用 tf 再应用 next 的复合变换
+func (tf Transform) Then(next Transform) Transform {
+	result := Transform{Transpose: tf.Transpose != next.Transpose}
+	for i := range loop9 {
+		if next.Transpose {
+			result.Rows[i] = tf.Cols[next.Rows[i]]
+			result.Cols[i] = tf.Rows[next.Cols[i]]
+		} else {
+			result.Rows[i] = tf.Rows[next.Rows[i]]
+			result.Cols[i] = tf.Cols[next.Cols[i]]
+		}
+		result.Nums[i] = next.Nums[tf.Nums[i]]
+	}
+	return result
+}
+
+// Inverse 返回逆变换，即 tf.Then(tf.Inverse()) 等于 IdentityTransform()
+func (tf Transform) Inverse() Transform {
+	result := Transform{Transpose: tf.Transpose}
+	for i := range loop9 {
+		if tf.Transpose {
+			result.Rows[tf.Cols[i]] = int8(i)
+			result.Cols[tf.Rows[i]] = int8(i)
+		} else {
+			result.Rows[tf.Rows[i]] = int8(i)
+			result.Cols[tf.Cols[i]] = int8(i)
+		}
+		result.Nums[tf.Nums[i]] = int8(i)
+	}
+	return result
+}
+
+// source 返回结果单元格 (r,c) 取自原局面的哪个单元格
+func (tf Transform) source(r, c int8) (int8, int8) {
+	if tf.Transpose {
+		return tf.Cols[c], tf.Rows[r]
+	}
+	return tf.Rows[r], tf.Cols[c]
+}
+
+// ApplyRCN 返回原局面的填数 rcn 在变换后的位置和数字
+func (tf Transform) ApplyRCN(rcn RowColNum) RowColNum {
+	return tf.applyRCN(tf.Inverse(), rcn)
+}
+
+// applyRCN 与 ApplyRCN 相同，inv 是预先算好的 tf.Inverse()，变换多个填数时只需计算一次
+func (tf Transform) applyRCN(inv Transform, rcn RowColNum) RowColNum {
+	r, c := inv.source(rcn.Row, rcn.Col)
+	n := rcn.Num
+	if n >= 0 {
+		n = tf.Nums[n]
+	}
+	return RCN(r, c, n)
+}
+
+// ApplyLine 对不换行的81个字符的谜题应用变换
+func (tf Transform) ApplyLine(line []byte) ([]byte, error) {
+	cells, err := ParseCellsFromLine(line)
+	if err != nil {
+		return nil, err
+	}
+	return FormatCellsLine(tf.ApplyCells(cells)), nil
+}
+
+// ApplySituation 对局势应用变换，返回新的局势和触发器。
+// 除了已填的数，所有排除信息和未处理的确认、矛盾也一并变换。
+// 额外的排除规则（MoveRules）、覆盖层（CellAttrs）和变体规则（VariantRules）在行列置换后不再成立，局势设置了它们时 panic。
+func (tf Transform) ApplySituation(s *Situation, t *Trigger) (*Situation, *Trigger) {
+	if s.moves != nil || s.attrs != nil || s.variant != nil {
+		panic(fmt.Errorf("transform: situation with move rules, overlay or variant rules cannot be transformed"))
+	}
+	s2 := NewSituation()
+	s2.branchGeneration = s.branchGeneration
+	for r := range loop9 {
+		for c := range loop9 {
+			r0, c0 := tf.source(int8(r), int8(c))
+			var mask int16
+			for n, n1 := range tf.Nums {
+				if s.numExcludeMask[r0][c0]&(1<<n) != 0 {
+					mask |= 1 << n1
+				}
+			}
+			s2.numExcludeMask[r][c] = mask
+
+			if n := s.cells[r0][c0]; n >= 0 {
+				n1 := tf.Nums[n]
+				b, _ := rcbp(int8(r), int8(c))
+				s2.cells[r][c] = n1
+				s2.hash ^= zobristKeys[r][c][n1]
+				s2.setCount++
+				s2.numSetCount[n1]++
+				s2.rowSetCount[r]++
+				s2.colSetCount[c]++
+				s2.blockSetCount[b]++
+			}
+		}
+	}
+	for r := range loop9 {
+		for c := range loop9 {
+			b, p := rcbp(int8(r), int8(c))
+			for n := range loop9 {
+				if s2.numExcludeMask[r][c]&(1<<n) == 0 {
+					continue
+				}
+				s2.cellExclude[n][r][c] = 1
+				s2.rowExcludeMask[n][r] |= 1 << c
+				s2.colExcludeMask[n][c] |= 1 << r
+				s2.blockExcludeMask[n][b] |= 1 << p
+			}
+		}
+	}
+
+	t2 := NewTrigger()
+	inv := tf.Inverse()
+	t.confirms.ForEach(func(rcn RowColNum) {
+		t2.Confirm(tf.applyRCN(inv, rcn))
+	})
+	for _, conflict := range t.Conflicts {
+		rcn := tf.applyRCN(inv, conflict.RowColNum)
+		conflictType := conflict.ConflictType
+		if tf.Transpose {
+			switch conflictType {
+			case ConflictRow:
+				conflictType = ConflictCol
+			case ConflictCol:
+				conflictType = ConflictRow
+			}
+		}
+		t2.Conflict(conflictType, rcn)
+	}
+	return s2, t2
+}
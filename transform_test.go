@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestTransformComposeInverse(t *testing.T) {
+	rnd := rand.New(rand.NewSource(2))
+	line := []byte("8..........36......7..9.2...5...7.......457.....1...3...1....68..85...1..9....4..")
+	cells, err := ParseCellsFromLine(line)
+	check(err)
+	for range 100 {
+		a := RandomTransform(rnd)
+		b := RandomTransform(rnd)
+		if err := a.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		if a.Then(a.Inverse()) != IdentityTransform() || a.Inverse().Then(a) != IdentityTransform() {
+			t.Fatalf("逆变换错误：%s", a)
+		}
+		composed := a.Then(b).ApplyCells(cells)
+		if *composed != *b.ApplyCells(a.ApplyCells(cells)) {
+			t.Fatalf("复合变换错误：%s ; %s", a, b)
+		}
+	}
+}
+
+func TestTransformRotate(t *testing.T) {
+	line := make([]byte, 81)
+	for i := range line {
+		line[i] = '.'
+	}
+	line[1] = '5' //(0,1)
+	rotated, err := RotateTransform(1).ApplyLine(line)
+	check(err)
+	//顺时针旋转90度后，(0,1) 到了 (1,8)
+	if rotated[1*9+8] != '5' {
+		t.Fatalf("旋转错误：%s", rotated)
+	}
+	if RotateTransform(1).Then(RotateTransform(1)) != RotateTransform(2) ||
+		RotateTransform(3).Then(RotateTransform(1)) != IdentityTransform() {
+		t.Fatal("旋转复合错误")
+	}
+	bad := IdentityTransform()
+	bad.Rows[2], bad.Rows[3] = bad.Rows[3], bad.Rows[2]
+	if bad.Validate() == nil {
+		t.Fatal("跨带交换行应该无效")
+	}
+}
+
+func TestTransformSituation(t *testing.T) {
+	puzzle, err := os.ReadFile("puzzles/hard-01.txt")
+	check(err)
+	s, trg := ParseSituation(string(puzzle))
+	ctx := NewSudokuContext()
+	ctx.Run(DuplicateSituation(s), DuplicateTrigger(trg))
+	solution := FormatCellsLine(ctx.solutions[0])
+
+	rnd := rand.New(rand.NewSource(3))
+	for range 10 {
+		tf := RandomTransform(rnd)
+		s2, t2 := tf.ApplySituation(s, trg)
+		ctx2 := NewSudokuContext()
+		if ctx2.Run(s2, t2) != 1 {
+			t.Fatal("变换后的谜题应该有唯一解")
+		}
+		inv := tf.Inverse()
+		back := FormatCellsLine(inv.ApplyCells(ctx2.solutions[0]))
+		if !bytes.Equal(back, solution) {
+			t.Fatalf("解映射回原谜题错误：%s != %s", back, solution)
+		}
+	}
+}
+
+func TestTransformSituationRules(t *testing.T) {
+	moves, err := NewMoveRules([]string{"anti-knight"})
+	check(err)
+	attrs, err := ParseCellAttrs(strings.Split(".........|.........|.........|.........|....e....|.........|.........|.........|.........", "|"))
+	check(err)
+	for _, set := range []func(s *Situation, trg *Trigger){
+		func(s *Situation, trg *Trigger) { s.SetMoveRules(trg, moves) },
+		func(s *Situation, trg *Trigger) { s.SetCellAttrs(trg, attrs) },
+	} {
+		s, trg := ParseSituation("")
+		set(s, trg)
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("带有额外规则的局势不能变换")
+				}
+			}()
+			TransposeTransform().ApplySituation(s, trg)
+		}()
+	}
+}
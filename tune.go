@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// HeuristicParams 是参数化的分支启发式，DefaultHeuristicParams 与 ChooseBranchCell1 完全相同。
+// 用于 tune 命令搜索更好的参数组合。
+type HeuristicParams struct {
+	//候选数相同时，评分 = RowWeight*行已填数 + ColWeight*列已填数 + BlockWeight*宫已填数，小的优先
+	RowWeight, ColWeight, BlockWeight int
+	//评分相同时用散列挑选：0 使用 RowColHash，其他值作为另一个散列函数的种子
+	HashSeed int64
+	//双值单元格按 CompareNumInCell 决定先猜哪个数，false 时从小到大
+	CompareNums bool
+	//CompareNums 中两个数已填的次数相同时用散列挑选：0 使用 CompareNumInCell 的散列，其他值作为另一个散列函数的种子
+	CompareSeed int64
+	//见 SudokuContext.GensApplyRules
+	GensApplyRules int
+	//求解时找到一个解即停止。搜索全部解时每个分支都要演算，先猜哪个数不影响结果，
+	//所以只有设置了它，CompareNums 和 CompareSeed 才有意义。TuneHeuristic 不修改它
+	StopAtFirstSolution bool
+}
+
+func DefaultHeuristicParams() HeuristicParams {
+	return HeuristicParams{
+		RowWeight:   1,
+		ColWeight:   1,
+		BlockWeight: 1,
+		CompareNums: true,
+	}
+}
+
+func (p HeuristicParams) String() string {
+	return fmt.Sprintf("row=%d col=%d block=%d hash=%d compare-nums=%v compare-seed=%d gens-apply-rules=%d one=%v",
+		p.RowWeight, p.ColWeight, p.BlockWeight, p.HashSeed, p.CompareNums, p.CompareSeed, p.GensApplyRules, p.StopAtFirstSolution)
+}
+
+// ChooseBranch 使 HeuristicParams 实现 BranchStrategy
+func (p HeuristicParams) ChooseBranch(s *Situation) *BranchChoices {
+	bestR, bestC := int8(-1), int8(-1)
+	var bestExcludes int8
+	var bestScore, bestHash int
+	for r := range int8(9) {
+		for c := range int8(9) {
+			excludes := countTrueBits(s.numExcludeMask[r][c])
+			if s.cells[r][c] != -1 || excludes > 7 || bestR >= 0 && excludes < bestExcludes {
+				continue
+			}
+			b, _ := rcbp(r, c)
+			score := p.RowWeight*int(s.rowSetCount[r]) +
+				p.ColWeight*int(s.colSetCount[c]) +
+				p.BlockWeight*int(s.blockSetCount[b])
+			if bestR >= 0 && excludes == bestExcludes && score > bestScore {
+				continue
+			}
+			hash := p.hash(s, r, c)
+			if bestR >= 0 && excludes == bestExcludes && score == bestScore && hash >= bestHash {
+				continue
+			}
+			bestR, bestC, bestExcludes, bestScore, bestHash = r, c, excludes, score, hash
+		}
+	}
+	if bestR < 0 {
+		return nil
+	}
+	result := s.cellChoices(bestR, bestC)
+	if p.CompareNums && result.Size() == 2 {
+		n0, n1 := result.Choices[0].Num, result.Choices[1].Num
+		if p.compareNums(s, bestR, bestC, n1, n0) {
+			result.Choices[0], result.Choices[1] = result.Choices[1], result.Choices[0]
+		}
+	}
+	return result
+}
+
+func (p HeuristicParams) hash(s *Situation, r, c int8) int {
+	if p.HashSeed == 0 {
+		return s.RowColHash(RowCol{r, c})
+	}
+	return int(splitmix64(uint64(p.HashSeed)^uint64(int(r)*9+int(c))<<8^uint64(s.setCount)<<16) >> 33)
+}
+
+// compareNums 与 CompareNumInCell 相同，只是已填的次数相同时按 CompareSeed 的散列挑选
+func (p HeuristicParams) compareNums(s *Situation, r, c, n1, n2 int8) bool {
+	if p.CompareSeed == 0 || s.numSetCount[n1] != s.numSetCount[n2] {
+		return s.CompareNumInCell(r, c, n1, n2)
+	}
+	base := uint64(p.CompareSeed) ^ uint64(int(r)*9+int(c))<<8 ^ uint64(s.setCount)<<16
+	return splitmix64(base^uint64(n1)<<24) < splitmix64(base^uint64(n2)<<24)
+}
+
+// TuneScore 是一组参数在测试集上的结果
+type TuneScore struct {
+	Branches  int
+	EvalCount int
+	Duration  time.Duration
+}
+
+// EvaluateHeuristic 用参数 p 单线程求解所有谜题，返回总分支数、总演算次数和耗时
+func EvaluateHeuristic(lines [][]byte, p HeuristicParams) TuneScore {
+	var score TuneScore
+	startTime := time.Now()
+	for _, line := range lines {
+		s, t := ParseSituationFromLine(line)
+		ctx := &SudokuContext{
+			GensApplyRules:      p.GensApplyRules,
+			StopAtFirstSolution: p.StopAtFirstSolution,
+			Strategy:            p,
+		}
+		ctx.Run(s, t)
+		for _, branches := range ctx.branchCount {
+			score.Branches += branches
+		}
+		score.EvalCount += ctx.evalCount
+		ReleaseSituation(s)
+		ReleaseTrigger(t)
+	}
+	score.Duration = time.Since(startTime)
+	return score
+}
+
+// TuneConfig 是 TuneHeuristic 的参数
+type TuneConfig struct {
+	//用于搜索参数的谜题
+	Train [][]byte
+	//搜索的轮数，每轮随机修改一个参数
+	Iterations int
+	//优化目标："branches" 总分支数，"time" 耗时
+	Objective string
+	//见 HeuristicParams.StopAtFirstSolution
+	StopAtFirstSolution bool
+	Rand                *rand.Rand
+	//不为 nil 时，每找到更好的参数调用一次
+	OnImprove func(iteration int, p HeuristicParams, score TuneScore)
+}
+
+// value 返回优化目标的值，越小越好
+func (cfg *TuneConfig) value(score TuneScore) float64 {
+	if cfg.Objective == "time" {
+		return score.Duration.Seconds()
+	}
+	return float64(score.Branches)
+}
+
+// TuneHeuristic 从 DefaultHeuristicParams 开始爬山搜索：每轮随机修改一个参数，
+// 在训练集上更好则保留。返回最好的参数和它在训练集上的结果。
+func TuneHeuristic(cfg *TuneConfig) (HeuristicParams, TuneScore) {
+	best := DefaultHeuristicParams()
+	best.StopAtFirstSolution = cfg.StopAtFirstSolution
+	bestScore := EvaluateHeuristic(cfg.Train, best)
+	for i := range cfg.Iterations {
+		p := best.mutate(cfg.Rand)
+		if p == best {
+			continue
+		}
+		score := EvaluateHeuristic(cfg.Train, p)
+		if cfg.value(score) < cfg.value(bestScore) {
+			best, bestScore = p, score
+			if cfg.OnImprove != nil {
+				cfg.OnImprove(i+1, best, bestScore)
+			}
+		}
+	}
+	return best, bestScore
+}
+
+// mutate 随机修改一个参数，不找到一个解即停止时不修改 CompareNums 和 CompareSeed
+func (p HeuristicParams) mutate(rnd *rand.Rand) HeuristicParams {
+	step := func(x, lo, hi int) int {
+		return min(max(x+rnd.Intn(2)*2-1, lo), hi)
+	}
+	switch rnd.Intn(7) {
+	case 0:
+		p.RowWeight = step(p.RowWeight, -3, 3)
+	case 1:
+		p.ColWeight = step(p.ColWeight, -3, 3)
+	case 2:
+		p.BlockWeight = step(p.BlockWeight, -3, 3)
+	case 3:
+		p.HashSeed = rnd.Int63n(1000)
+	case 4:
+		if p.StopAtFirstSolution {
+			p.CompareNums = !p.CompareNums
+		}
+	case 5:
+		p.GensApplyRules = step(p.GensApplyRules, 0, 3)
+	case 6:
+		if p.StopAtFirstSolution {
+			p.CompareSeed = rnd.Int63n(1000)
+		}
+	}
+	return p
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestDefaultHeuristicParams(t *testing.T) {
+	for _, line := range readPuzzleLines(openInput("assets/hardest_1106.txt"))[:50] {
+		s, trg := ParseSituationFromLine(line)
+		expected := NewSudokuContext()
+		expected.Run(DuplicateSituation(s), DuplicateTrigger(trg))
+		ctx := &SudokuContext{Strategy: DefaultHeuristicParams()}
+		ctx.Run(s, trg)
+		if ctx.evalCount != expected.evalCount || ctx.branchCount != expected.branchCount {
+			t.Fatalf("默认参数应与 ChooseBranchCell1 完全相同：%s", line)
+		}
+	}
+
+	//找到一个解即停止时，CompareSeed 替换 CompareNumInCell 的散列，改变先猜的数
+	lines := readPuzzleLines(openInput("assets/hardest_1106.txt"))[:50]
+	first := DefaultHeuristicParams()
+	first.StopAtFirstSolution = true
+	seeded := first
+	seeded.CompareSeed = 7
+	if EvaluateHeuristic(lines, seeded).Branches == EvaluateHeuristic(lines, first).Branches {
+		t.Fatal("CompareSeed 没有影响分支")
+	}
+}
+
+func TestTuneHeuristic(t *testing.T) {
+	train := readPuzzleLines(openInput("assets/hardest_1106.txt"))[:30]
+	initial := EvaluateHeuristic(train, DefaultHeuristicParams())
+	improved := 0
+	best, score := TuneHeuristic(&TuneConfig{
+		Train:      train,
+		Iterations: 10,
+		Rand:       rand.New(rand.NewSource(1)),
+		OnImprove: func(iteration int, p HeuristicParams, score TuneScore) {
+			improved++
+		},
+	})
+	if score.Branches > initial.Branches || improved > 0 && best == DefaultHeuristicParams() {
+		t.Fatalf("搜索结果比默认参数差：%d > %d", score.Branches, initial.Branches)
+	}
+	if again := EvaluateHeuristic(train, best); again.Branches != score.Branches {
+		t.Fatalf("同样的参数结果不同：%d != %d", again.Branches, score.Branches)
+	}
+}
@@ -239,6 +239,13 @@ func (q *Queue) Dequeue() (item RowColNum, ok bool) {
 	return
 }
 
+// ForEach 按出队顺序遍历队列中的元素，不改变队列
+func (q *Queue) ForEach(f func(item RowColNum)) {
+	for i := q.head; i != q.tail; i = (i + 1) & q.mask {
+		f(q.values[i])
+	}
+}
+
 func (q *Queue) DiscardAll() {
 	q.head = q.tail
 }
@@ -303,11 +310,14 @@ const (
 	ConflictRow   = 2
 	ConflictCol   = 3
 	ConflictBlock = 4
+	//变体规则的矛盾，原因见 Reason
+	ConflictVariant = 5
 )
 
 type Conflict struct {
 	ConflictType int
 	RowColNum
+	Reason string
 }
 
 func (c Conflict) String() string {
@@ -320,7 +330,15 @@ func (c Conflict) String() string {
 		return fmt.Sprintf("列 %d 没有单元格可以填 %d", c.Col+1, c.Num+1)
 	case ConflictBlock:
 		return fmt.Sprintf("宫 (%d,%d) 没有单元格可以填 %d", c.Row/3+1, c.Col/3+1, c.Num+1)
+	case ConflictVariant:
+		return c.Reason
 	default:
 		return ""
 	}
 }
+
+func check(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
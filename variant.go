@@ -0,0 +1,474 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// VariantPuzzle 是变体数独谜题：已知数，以及在标准规则之外启用的变体
+type VariantPuzzle struct {
+	//标题、作者等元数据，不影响求解
+	Info PuzzleInfo
+	//Givens[i] 是单元格 i 的已知数（0~8），-1 为空
+	Givens []int8
+	//不为 nil 时是合体数独，Gattai[k] 是第 k 个 9*9 盘面左上角的位置，见 NewGattaiLayout
+	Gattai []RowCol
+	//启用的变体，见 VariantNames
+	Variants []string
+	//不为 nil 时是不规则区域数独（jigsaw），Regions[i] 是单元格 i 所在区域的编号 0~8，区域代替宫
+	Regions []int8
+	//不为 nil 时是覆盖层声明的偶数格、奇数格、堡垒格
+	Attrs *CellAttrs
+	//杀手数独的笼子
+	Cages []Cage
+	//相邻单元格之间的标记：Kropki、XV、大于号
+	Relations []Relation
+	//启用否定约束的标记分组，见 NegativeGroups
+	Negative []string
+	//线约束
+	Lines []Line
+	//盘面外的线索
+	Outside []OutsideClue
+
+	layout *Layout
+	//所有约束，包括由笼子生成的内侧、外侧规则
+	constraints []Constraint
+	//constraints[:ruleConstraints] 是反马步等规则和覆盖层的约束，Situation 用 SetMoveRules、SetCellAttrs 代替它们
+	ruleConstraints int
+	//variant 指令中的反马步、反王步、非连续规则
+	moves *MoveRules
+}
+
+// PuzzleInfo 是谜题的元数据，在谜题文件中用 title、author、source、rating 指令写出
+type PuzzleInfo struct {
+	Title  string
+	Author string
+	//出处，例如书名或网址
+	Source string
+	//难度评级，格式不限，例如 "3/5" 或者 "SE 7.2"
+	Rating string
+}
+
+// Layout 返回谜题的盘面：行、列、宫（或不规则区域），加上变体的额外的房
+func (vp *VariantPuzzle) Layout() *Layout {
+	if vp.layout == nil {
+		vp.build()
+	}
+	return vp.layout
+}
+
+// Constraints 返回谜题的所有约束
+func (vp *VariantPuzzle) Constraints() []Constraint {
+	if vp.layout == nil {
+		vp.build()
+	}
+	return vp.constraints
+}
+
+// build 根据谜题的声明生成 Layout 和约束
+func (vp *VariantPuzzle) build() {
+	var l *Layout
+	var moveNames []string
+	if vp.Gattai != nil {
+		l = NewGattaiLayout(vp.Gattai)
+	} else {
+		houses := LineHouses()
+		if vp.Regions != nil {
+			houses = append(houses, RegionHouses(vp.Regions)...)
+		} else {
+			houses = append(houses, BlockHouses()...)
+		}
+		for _, name := range vp.Variants {
+			if houseVariants[name] != nil {
+				houses = append(houses, houseVariants[name]()...)
+			} else {
+				moveNames = append(moveNames, name)
+			}
+		}
+		l = NewLayout(9, 9, houses)
+		if vp.Regions != nil {
+			l.outline = make([]int, l.Size())
+			for i, x := range vp.Regions {
+				l.outline[i] = int(x)
+			}
+		}
+	}
+
+	vp.constraints = nil
+	vp.moves, _ = NewMoveRules(moveNames)
+	if vp.moves != nil {
+		vp.constraints = append(vp.constraints, vp.moves.apply(l)...)
+	}
+	if vp.Attrs != nil {
+		vp.constraints = append(vp.constraints, vp.Attrs.apply(l)...)
+	}
+	vp.ruleConstraints = len(vp.constraints)
+	if len(vp.Cages) > 0 {
+		//没有笼子的单元格各自作为一个区域
+		l.outline = make([]int, l.Size())
+		for i := range l.outline {
+			l.outline[i] = -1 - i
+		}
+		l.outlineLabels = make(map[int]string)
+		for k := range vp.Cages {
+			cage := &vp.Cages[k]
+			l.addPeers(cage.Cells)
+			for _, i := range cage.Cells {
+				l.outline[i] = k
+			}
+			l.outlineLabels[slices.Min(cage.Cells)] = strconv.Itoa(cage.Sum)
+			vp.constraints = append(vp.constraints, cage)
+		}
+		vp.constraints = append(vp.constraints, killerRules(l, vp.Cages)...)
+	}
+	if len(vp.Relations) > 0 || len(vp.Negative) > 0 {
+		l.blockOutline()
+		l.marks = make(map[[2]int]string)
+		for k := range vp.Relations {
+			x := &vp.Relations[k]
+			l.marks[[2]int{min(x.A, x.B), max(x.A, x.B)}] = x.mark(x.A%l.Cols == x.B%l.Cols)
+		}
+		vp.constraints = append(vp.constraints, relationRules(l, vp.Relations, vp.Negative)...)
+	}
+	for k := range vp.Lines {
+		x := &vp.Lines[k]
+		if lineKinds[x.Kind].distinct {
+			l.addPeers(x.Cells)
+		}
+		vp.constraints = append(vp.constraints, x)
+	}
+	if len(vp.Outside) > 0 {
+		l.blockOutline()
+		vp.constraints = append(vp.constraints, outsideRules(l, vp.Outside)...)
+	}
+	vp.layout = l
+}
+
+// NewGrid 返回填入已知数的局势，已知数互相矛盾时局势的 Conflict 不为空
+func (vp *VariantPuzzle) NewGrid() *Grid {
+	g := NewGrid(vp.Layout())
+	for i, n := range vp.Givens {
+		if n >= 0 {
+			g.Set(i, n)
+		}
+	}
+	return g
+}
+
+// variantParser 逐行读取谜题文件
+type variantParser struct {
+	vp *VariantPuzzle
+	//盘面的形状，用于解析单元格
+	shape *Layout
+	lines []string
+	//下一行的下标
+	pos int
+}
+
+// next 返回下一个非空、非注释的行
+func (p *variantParser) next() (string, bool) {
+	for p.pos < len(p.lines) {
+		line := strings.TrimRight(p.lines[p.pos], "\r")
+		p.pos++
+		fields := strings.Fields(line)
+		if line == "" || len(fields) > 0 && strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		return line, true
+	}
+	return "", false
+}
+
+// nextRows 返回接下来的 n 行，去除首尾空白
+func (p *variantParser) nextRows(n int) ([]string, error) {
+	var rows []string
+	for range n {
+		line, ok := p.next()
+		if !ok {
+			return nil, fmt.Errorf("expect %d rows, got %d", n, len(rows))
+		}
+		rows = append(rows, strings.TrimSpace(line))
+	}
+	return rows, nil
+}
+
+// variantDirectives 是谜题文件中除盘面以外的指令，第一个词是指令名，args 是同一行的其他词
+var variantDirectives = map[string]func(p *variantParser, args []string) error{
+	"title":  func(p *variantParser, args []string) error { p.vp.Info.Title = strings.Join(args, " "); return nil },
+	"author": func(p *variantParser, args []string) error { p.vp.Info.Author = strings.Join(args, " "); return nil },
+	"source": func(p *variantParser, args []string) error { p.vp.Info.Source = strings.Join(args, " "); return nil },
+	"rating": func(p *variantParser, args []string) error { p.vp.Info.Rating = strings.Join(args, " "); return nil },
+	"variant": func(p *variantParser, args []string) error {
+		for _, name := range args {
+			if houseVariants[name] == nil && moveRules[name] == nil {
+				return fmt.Errorf("unknown variant %q, available: %v", name, VariantNames())
+			}
+			p.vp.Variants = append(p.vp.Variants, name)
+		}
+		return nil
+	},
+	//cage <和> <单元格>... ：杀手数独的笼子，例如 cage 15 r1c1 r1c2 r2c1
+	"cage": func(p *variantParser, args []string) error {
+		if len(args) < 2 {
+			return fmt.Errorf("cage: expect sum and cells")
+		}
+		sum, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("cage: invalid sum %q", args[0])
+		}
+		cells, err := parseCells(p.shape, args[1:])
+		if err != nil {
+			return fmt.Errorf("cage: %w", err)
+		}
+		cage := Cage{Sum: sum, Cells: cells}
+		if err := cage.validate(); err != nil {
+			return fmt.Errorf("cage: %w", err)
+		}
+		for _, other := range p.vp.Cages {
+			for _, i := range cells {
+				if slices.Contains(other.Cells, i) {
+					return fmt.Errorf("cage: cell %s is already in another cage", p.shape.CellName(i))
+				}
+			}
+		}
+		p.vp.Cages = append(p.vp.Cages, cage)
+		return nil
+	},
+	//kropki white|black <单元格> <单元格>... ：Kropki 白点（两数相差 1）、黑点（一个数是另一个的两倍），每两个单元格一对
+	"kropki": func(p *variantParser, args []string) error {
+		if len(args) == 0 || args[0] != "white" && args[0] != "black" {
+			return fmt.Errorf("kropki: expect white or black")
+		}
+		relations, err := parseRelations(p.shape, args[0], args[1:])
+		if err != nil {
+			return fmt.Errorf("kropki: %w", err)
+		}
+		p.vp.Relations = append(p.vp.Relations, relations...)
+		return nil
+	},
+	//xv x|v <单元格> <单元格>... ：两数的和为 10（X）或 5（V）
+	"xv": func(p *variantParser, args []string) error {
+		if len(args) == 0 || args[0] != "x" && args[0] != "v" {
+			return fmt.Errorf("xv: expect x or v")
+		}
+		relations, err := parseRelations(p.shape, args[0], args[1:])
+		if err != nil {
+			return fmt.Errorf("xv: %w", err)
+		}
+		p.vp.Relations = append(p.vp.Relations, relations...)
+		return nil
+	},
+	//gt <单元格> <单元格>... ：每对中前一个单元格的数大于后一个
+	"gt": func(p *variantParser, args []string) error {
+		relations, err := parseRelations(p.shape, "gt", args)
+		if err != nil {
+			return fmt.Errorf("gt: %w", err)
+		}
+		p.vp.Relations = append(p.vp.Relations, relations...)
+		return nil
+	},
+	//negative kropki|xv ：否定约束，没有标记的相邻单元格不满足这一组标记的关系
+	"negative": func(p *variantParser, args []string) error {
+		for _, group := range args {
+			if !slices.Contains(NegativeGroups(), group) {
+				return fmt.Errorf("negative: unknown group %q, available: %v", group, NegativeGroups())
+			}
+			p.vp.Negative = append(p.vp.Negative, group)
+		}
+		return nil
+	},
+	//gattai <名称>|<左上角的单元格>... ：合体数独，例如 gattai samurai，必须写在其他指令之前
+	"gattai": func(p *variantParser, args []string) error {
+		vp := p.vp
+		if vp.Gattai != nil || len(vp.Variants) > 0 || vp.Regions != nil || vp.Attrs != nil || len(vp.Cages) > 0 ||
+			len(vp.Relations) > 0 || len(vp.Negative) > 0 || len(vp.Lines) > 0 || len(vp.Outside) > 0 {
+			return fmt.Errorf("gattai: should be the first directive")
+		}
+		corners, err := parseGattai(args)
+		if err != nil {
+			return fmt.Errorf("gattai: %w", err)
+		}
+		vp.Gattai = corners
+		p.shape = NewGattaiLayout(corners)
+		return nil
+	},
+	//overlay 之后的 9 行是覆盖层，见 ParseCellAttrs
+	"overlay": func(p *variantParser, args []string) error {
+		rows, err := p.nextRows(9)
+		if err != nil {
+			return fmt.Errorf("overlay: %w", err)
+		}
+		p.vp.Attrs, err = ParseCellAttrs(rows)
+		return err
+	},
+	//regions 之后的 9 行是区域图，见 ParseRegions
+	"regions": func(p *variantParser, args []string) error {
+		rows, err := p.nextRows(9)
+		if err != nil {
+			return fmt.Errorf("regions: %w", err)
+		}
+		p.vp.Regions, err = ParseRegions(rows)
+		return err
+	},
+}
+
+// ParseVariantPuzzle 解析变体谜题文件：
+// 盘面是9行9个字符（或者一行81个字符），1~9 是已知数，其他字符代表空单元格；
+// 合体数独的盘面是整个拼图的行，不在盘面上的位置写空格。
+// 其他行是指令，例如 "variant x windoku"，空行和 # 开头的注释行忽略。
+func ParseVariantPuzzle(text string) (*VariantPuzzle, error) {
+	p := &variantParser{
+		vp:    &VariantPuzzle{},
+		shape: NewLayout(9, 9, nil),
+		lines: strings.Split(text, "\n"),
+	}
+	var rows []string
+	for {
+		line, ok := p.next()
+		if !ok {
+			break
+		}
+		lineNo := p.pos
+		fields := strings.Fields(line)
+		if len(fields) > 0 {
+			if directive, ok := variantDirectives[fields[0]]; ok {
+				if err := directive(p, fields[1:]); err != nil {
+					return nil, fmt.Errorf("line %d: %w", lineNo, err)
+				}
+				continue
+			}
+		}
+		if strings.TrimLeft(line, "123456789.0_ ") != "" {
+			return nil, fmt.Errorf("line %d: unknown directive %q", lineNo, fields[0])
+		}
+		rows = append(rows, line)
+	}
+	return p.finish(rows)
+}
+
+// finish 在所有指令之后解析盘面的行，检查指令之间的冲突，返回谜题。一行写出整个盘面时按列数分成多行。
+func (p *variantParser) finish(rows []string) (*VariantPuzzle, error) {
+	l, vp := p.shape, p.vp
+	if len(rows) == 1 && len(rows[0]) == l.Size() {
+		line := rows[0]
+		rows = nil
+		for r := range l.Rows {
+			rows = append(rows, line[r*l.Cols:(r+1)*l.Cols])
+		}
+	}
+	if len(rows) != l.Rows {
+		return nil, fmt.Errorf("expect %d rows, got %d", l.Rows, len(rows))
+	}
+	if vp.Gattai != nil && (len(vp.Variants) > 0 || vp.Regions != nil || vp.Attrs != nil || len(vp.Outside) > 0) {
+		return nil, fmt.Errorf("gattai: variant, regions, overlay and outside clues are only supported on a single grid")
+	}
+	vp.Givens = make([]int8, l.Size())
+	for r, row := range rows {
+		row = strings.TrimRight(row, " ")
+		if len(row) > l.Cols {
+			return nil, fmt.Errorf("row %d: too long", r+1)
+		}
+		for c := range l.Cols {
+			i := l.Index(r, c)
+			vp.Givens[i] = -1
+			if c < len(row) && row[c] >= '1' && row[c] <= '9' {
+				if !l.Present(i) {
+					return nil, fmt.Errorf("row %d: cell %s is not on any grid", r+1, l.CellName(i))
+				}
+				vp.Givens[i] = int8(row[c] - '1')
+			}
+		}
+	}
+	return vp, nil
+}
+
+// String 返回谜题文件的文本，ParseVariantPuzzle 可以解析
+func (vp *VariantPuzzle) String() string {
+	var sb strings.Builder
+	for _, meta := range [][2]string{
+		{"title", vp.Info.Title}, {"author", vp.Info.Author}, {"source", vp.Info.Source}, {"rating", vp.Info.Rating},
+	} {
+		if meta[1] != "" {
+			fmt.Fprintf(&sb, "%s %s\n", meta[0], meta[1])
+		}
+	}
+	if vp.Gattai != nil {
+		sb.WriteString(gattaiDirective(vp.Gattai))
+		sb.WriteByte('\n')
+	}
+	if len(vp.Variants) > 0 {
+		fmt.Fprintf(&sb, "variant %s\n", strings.Join(vp.Variants, " "))
+	}
+	if vp.Regions != nil {
+		sb.WriteString("regions\n")
+		for _, row := range vp.regionRows() {
+			sb.WriteString(row + "\n")
+		}
+	}
+	if vp.Attrs != nil {
+		sb.WriteString("overlay\n")
+		sb.WriteString(vp.Attrs.String())
+	}
+	l := vp.Layout()
+	for k := range vp.Cages {
+		sb.WriteString(vp.Cages[k].Directive(l))
+		sb.WriteByte('\n')
+	}
+	if len(vp.Negative) > 0 {
+		fmt.Fprintf(&sb, "negative %s\n", strings.Join(vp.Negative, " "))
+	}
+	for k := range vp.Relations {
+		sb.WriteString(vp.Relations[k].Directive(l))
+		sb.WriteByte('\n')
+	}
+	for k := range vp.Lines {
+		sb.WriteString(vp.Lines[k].Directive(l))
+		sb.WriteByte('\n')
+	}
+	for k := range vp.Outside {
+		sb.WriteString(vp.Outside[k].Directive(l))
+		sb.WriteByte('\n')
+	}
+	for _, row := range vp.givenRows() {
+		sb.WriteString(row + "\n")
+	}
+	return sb.String()
+}
+
+// givenRows 返回盘面的每一行：已知数、. 代表空单元格，合体数独不在盘面上的位置是空格
+func (vp *VariantPuzzle) givenRows() []string {
+	l := vp.Layout()
+	var rows []string
+	for r := range l.Rows {
+		var row []byte
+		for c := range l.Cols {
+			i := l.Index(r, c)
+			switch {
+			case !l.Present(i):
+				row = append(row, ' ')
+			case vp.Givens[i] >= 0:
+				row = append(row, byte('1'+vp.Givens[i]))
+			default:
+				row = append(row, '.')
+			}
+		}
+		rows = append(rows, string(bytes.TrimRight(row, " ")))
+	}
+	return rows
+}
+
+// regionRows 返回区域图的 9 行，区域用 A~I 表示
+func (vp *VariantPuzzle) regionRows() []string {
+	var rows []string
+	for r := range 9 {
+		var row []byte
+		for c := range 9 {
+			row = append(row, byte('A'+vp.Regions[r*9+c]))
+		}
+		rows = append(rows, string(row))
+	}
+	return rows
+}
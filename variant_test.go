@@ -0,0 +1,290 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// extraHouseClauses 返回盘面中标准的行、列、宫以外的房的 SAT 子句，用于交叉检验
+func extraHouseClauses(l *Layout) [][]int {
+	var clauses [][]int
+	for _, house := range l.Houses[27:] {
+		var cells []RowCol
+		for _, i := range house.Cells {
+			r, c := l.RowCol(i)
+			cells = append(cells, RowCol{int8(r), int8(c)})
+		}
+		clauses = append(clauses, AllDifferentClauses(cells)...)
+	}
+	return clauses
+}
+
+// applyConstraints 在 g 上应用一遍谜题的所有约束，返回是否有新的排除，用于单独检验约束的排除
+func applyConstraints(g *Grid, vp *VariantPuzzle) bool {
+	changed := false
+	for _, c := range vp.Constraints() {
+		if c.Propagate(g) {
+			changed = true
+		}
+		if g.Conflict() != "" {
+			return true
+		}
+	}
+	return changed
+}
+
+// VariantSolver 只求解 Situation 不能表示的盘面；不规则区域数独有多个解时，每个解都应该满足所有的房
+func TestVariantSolverScope(t *testing.T) {
+	for _, vp := range []*VariantPuzzle{{}, {Variants: []string{"x", "anti-knight"}}} {
+		if NewVariantSolver(vp).Validate() == nil {
+			t.Fatalf("%v：标准盘面应该在 Situation 上求解", vp.Variants)
+		}
+	}
+
+	raw, err := os.ReadFile("puzzles/jigsaw-01.txt")
+	check(err)
+	vp, err := ParseVariantPuzzle(string(raw))
+	check(err)
+	for i := range 27 {
+		vp.Givens[i] = -1
+	}
+	seen := make(map[[81]int8]bool)
+	count := NewVariantSolver(vp).Run(func(g *Grid) bool {
+		for _, house := range g.Layout().Houses {
+			var used int16
+			for _, i := range house.Cells {
+				used |= 1 << g.Get(i)
+			}
+			if used != 511 {
+				t.Fatalf("%s 有重复的数字", house.Name)
+			}
+		}
+		for i, n := range vp.Givens {
+			if n >= 0 && g.Get(i) != n {
+				t.Fatal("解与已知数不一致")
+			}
+		}
+		seen[[81]int8(g.cells)] = true
+		return true
+	})
+	if count < 2 || len(seen) != count {
+		t.Fatalf("应该找到多个不同的解，找到 %d 个，其中 %d 个不同", count, len(seen))
+	}
+}
+
+func TestVariantHouses(t *testing.T) {
+	for _, name := range VariantNames() {
+		vp := &VariantPuzzle{Variants: []string{name}}
+		rules, err := NewVariantRules(vp)
+		check(err)
+		vs := &PropagationSolver{Variant: rules}
+		//取空盘面的第一个解，清空前三行，得到有多个解的谜题
+		var puzzle [9][9]int8
+		vs.Solve(&EmptySituation.cells, func(solution *[9][9]int8) bool {
+			puzzle = *solution
+			return false
+		})
+		for i := range 27 {
+			puzzle[i/9][i%9] = -1
+		}
+		sat := NewSATSolver()
+		sat.ExtraClauses = extraHouseClauses(vp.Layout())
+		if moveRules[name] != nil {
+			moves, err := NewMoveRules([]string{name})
+			check(err)
+			sat.ExtraClauses = moveClauses(moves)
+		}
+		crossCheckSolvers(t, vs, sat, &puzzle)
+		t.Logf("%s：%d 个解", name, len(solveAll(vs, &puzzle)))
+	}
+}
+
+func TestVariantPuzzleFiles(t *testing.T) {
+	for _, filename := range []string{"puzzles/x-01.txt", "puzzles/windoku-01.txt", "puzzles/jigsaw-01.txt"} {
+		raw, err := os.ReadFile(filename)
+		check(err)
+		vp, err := ParseVariantPuzzle(string(raw))
+		check(err)
+		yield := func(g *Grid) bool {
+			for _, house := range g.Layout().Houses {
+				var used int16
+				for _, i := range house.Cells {
+					used |= 1 << g.Get(i)
+				}
+				if used != 511 {
+					t.Fatalf("%s：%s 有重复的数字", filename, house.Name)
+				}
+			}
+			return true
+		}
+		count, err := vp.Run(NewSudokuContext(), yield)
+		if vp.Regions != nil {
+			count = NewVariantSolver(vp).Run(yield)
+		} else {
+			check(err)
+		}
+		if count != 1 {
+			t.Fatalf("%s 应该有唯一解，找到 %d 个", filename, count)
+		}
+	}
+}
+
+func TestParseVariantPuzzle(t *testing.T) {
+	line := "variant x centre-dot\n" + string(readPuzzleLines(openInput("puzzles/hard-02.txt"))[0])
+	vp, err := ParseVariantPuzzle(line)
+	check(err)
+	if len(vp.Variants) != 2 || len(vp.Layout().Houses) != 27+3 {
+		t.Fatalf("变体解析错误：%v", vp.Variants)
+	}
+	for _, bad := range []string{
+		"variant y\n" + multiSolutionPuzzle,
+		"cage 10 r1c1\n" + multiSolutionPuzzle,
+		"...7.....\n",
+	} {
+		if _, err := ParseVariantPuzzle(bad); err == nil {
+			t.Fatalf("应该返回错误：%q", bad)
+		}
+	}
+}
+
+func TestParseRegions(t *testing.T) {
+	rows := []string{
+		"AAABBCCCC",
+		"AABBBBBCC",
+		"DAAEBBCCF",
+		"DDAEEEFCF",
+		"DDAEEFFFF",
+		"DDDDEEEFF",
+		"GGGHHHHII",
+		"GGHHHIIII",
+		"GGGGHHIII",
+	}
+	regions, err := ParseRegions(rows)
+	check(err)
+	if regions[0] != 0 || regions[80] != 8 || regions[2*9+1] != 0 || regions[2*9] != 3 {
+		t.Fatalf("区域编号错误：%v", regions)
+	}
+
+	bad := func(name string, rows []string) {
+		if _, err := ParseRegions(rows); err == nil {
+			t.Fatalf("%s：应该返回错误", name)
+		} else {
+			t.Logf("%s：%v", name, err)
+		}
+	}
+	bad("行数", rows[:8])
+	//交换左上角和右下角的单元格后，A 和 I 都不连通
+	disconnected := append([]string(nil), rows...)
+	disconnected[0] = "IAABBCCCC"
+	disconnected[8] = "GGGGHHIIA"
+	bad("不连通", disconnected)
+	sizes := append([]string(nil), rows...)
+	sizes[0] = "AAAABCCCC"
+	bad("大小", sizes)
+	tooMany := append([]string(nil), rows...)
+	tooMany[8] = "GGGGHHIIJ"
+	bad("区域数", tooMany)
+
+	//区域代替宫：标准的宫不再是约束
+	vp := &VariantPuzzle{Regions: regions}
+	for _, house := range vp.Layout().Houses {
+		if strings.HasPrefix(house.Name, "第") && strings.HasSuffix(house.Name, "宫") {
+			t.Fatalf("不规则区域数独不应该有 %s", house.Name)
+		}
+	}
+}
+
+// 在 Situation 上求解变体谜题，解应该满足谜题的所有约束，迭代搜索、多线程搜索和复杂排除规则的结果应该相同
+func TestVariantSituation(t *testing.T) {
+	files, err := filepath.Glob("puzzles/*-01.*")
+	check(err)
+	for _, filename := range files {
+		name := strings.TrimSuffix(filepath.Base(filename), "-01"+filepath.Ext(filename))
+		if name == "hard" || name == "simple" {
+			continue
+		}
+		raw, err := os.ReadFile(filename)
+		check(err)
+		if moveRules[name] != nil {
+			//这些谜题用于 -moves 选项，没有 variant 指令
+			raw = append([]byte("variant "+name+"\n"), raw...)
+		}
+		var vp *VariantPuzzle
+		if filepath.Ext(filename) == ".json" {
+			vp, err = ParseVariantJSON(raw)
+		} else {
+			vp, err = ParseVariantPuzzle(string(raw))
+		}
+		check(err)
+		rules, err := NewVariantRules(vp)
+		if err != nil {
+			if vp.Gattai == nil && vp.Regions == nil {
+				t.Fatalf("%s：%v", filename, err)
+			}
+			continue
+		}
+		//递归搜索的解应该满足所有的房和约束，其他搜索方式的解与它相同
+		var expected [][9][9]int8
+		var cells [9][9]int8
+		_, err = vp.Run(NewSudokuContext(), func(g *Grid) bool {
+			for _, house := range g.Layout().Houses {
+				var used int16
+				for _, i := range house.Cells {
+					used |= 1 << g.Get(i)
+				}
+				if used != 511 {
+					t.Fatalf("%s：%s 有重复的数字", filename, house.Name)
+				}
+			}
+			for _, c := range vp.Constraints() {
+				if c.Propagate(g) || g.Conflict() != "" {
+					t.Fatalf("%s：%s 不成立", filename, c.Directive(g.Layout()))
+				}
+			}
+			g.ToCells(&cells)
+			expected = append(expected, cells)
+			return true
+		})
+		check(err)
+		if len(expected) == 0 {
+			t.Fatalf("%s 没有解", filename)
+		}
+		for _, ctx := range []*SudokuContext{
+			{Iterative: true},
+			{Parallel: 3},
+			{AdaptiveRules: true},
+			{GensApplyRules: 81},
+		} {
+			s, trg, err := vp.NewSituation()
+			check(err)
+			ctx.Run(s, trg)
+			if len(ctx.solutions) != len(expected) {
+				t.Fatalf("%s：%+v 找到 %d 个解，应为 %d 个", filename, ctx, len(ctx.solutions), len(expected))
+			}
+			for _, solution := range ctx.solutions {
+				if !slices.Contains(expected, *solution) {
+					t.Fatalf("%s：%+v 找到了不同的解 %s", filename, ctx, FormatCellsLine(solution))
+				}
+			}
+		}
+		if clauses, err := rules.Clauses(); err == nil {
+			x := NewSATSolver()
+			x.ExtraClauses = clauses
+			var givens [9][9]int8
+			for i, n := range vp.Givens {
+				givens[i/9][i%9] = n
+			}
+			var solutions [][9][9]int8
+			x.Solve(&givens, func(solution *[9][9]int8) bool {
+				solutions = append(solutions, *solution)
+				return true
+			})
+			if !slices.Equal(solutions, expected) {
+				t.Fatalf("%s：SATSolver 找到了不同的解", filename)
+			}
+		}
+	}
+}